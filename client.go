@@ -1,13 +1,19 @@
 package http
 
 import (
-	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	stdurl "net/url"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/http/client"
+	"github.com/gorilla/http/client/http2"
 )
 
 // Client implements a high level HTTP client. Client methods can be called concurrently
@@ -17,47 +23,193 @@ type Client struct {
 
 	// FollowRedirects instructs the client to follow 301/302 redirects when idempotent.
 	FollowRedirects bool
+
+	// ExpectContinue, if non zero, causes requests with a body to be sent with an
+	// Expect: 100-continue header. The body is sent once the server responds with
+	// 100 Continue, or after waiting ExpectContinue for a response. If the server
+	// responds with a final status first, for example to reject the request, the
+	// body is not sent.
+	ExpectContinue time.Duration
+
+	// TLSConfig, if non nil, configures the TLS connections used by https requests.
+	TLSConfig *tls.Config
+
+	// HTTP2 offers HTTP/2 to https servers using ALPN. Servers which accept
+	// share a single connection between all requests, otherwise HTTP/1.1 is used.
+	HTTP2 bool
+
+	// H2C sends http requests using HTTP/2 over plain TCP with prior
+	// knowledge, rfc 7540 s3.4. The server must support it.
+	H2C bool
+
+	// DisableDecompression stops the client from sending Accept-Encoding and
+	// decoding compressed responses. Otherwise requests without an
+	// Accept-Encoding header advertise every coding registered with
+	// RegisterDecoder, and responses encoded with them are decoded, with the
+	// Content-Encoding and Content-Length headers removed. A single request
+	// may opt out by sending Accept-Encoding: identity.
+	DisableDecompression bool
+
+	// Limits bounds the size of the response bodies read.
+	Limits Limits
+
+	// RequestEncoding, if "gzip" or "zstd", compresses request bodies with that
+	// content coding as they are sent, adding a Content-Encoding header. As
+	// the compressed length is unknown, bodies are sent using chunked
+	// encoding. Requests which already carry a Content-Encoding are sent as
+	// given.
+	RequestEncoding string
+
+	// RequestEncodingFallback sends a compressed request again, uncompressed,
+	// if the server responds 415 Unsupported Media Type without accepting the
+	// RequestEncoding, rfc 7694. The body must be an io.Seeker.
+	RequestEncodingFallback bool
+
+	// OnLeak is the action taken when a response body is garbage collected
+	// without being closed, leaking its connection. By default the leak is
+	// logged with the call site of the request.
+	OnLeak LeakAction
+
+	// Tracer, if non nil, starts a span for each request.
+	Tracer Tracer
+
+	// Metrics, if non nil, counts the requests made and reports the
+	// statistics of the connection pool.
+	Metrics *Metrics
+
+	// logger is the *slog.Logger set by SetLogger, if any.
+	logger any
+
+	// RedactHeaders and RedactParams name further headers, matched case
+	// insensitively, and query parameters whose values are redacted from
+	// logs, see SetLogger.
+	RedactHeaders, RedactParams []string
+
+	// Transcript, if non nil, records the bytes of HTTP/1.x requests and
+	// responses as they are sent and received, including those of
+	// connections taken from the pool. See client.Transcript.
+	Transcript *client.Transcript
+
+	// PropagateTraceContext sends the TraceParent carried by the context of
+	// a request, see WithTraceParent, as its traceparent and tracestate
+	// headers, unless the request already carries a traceparent.
+	PropagateTraceContext bool
 }
 
 // Do sends an HTTP request and returns an HTTP response. If the response body is non nil
 // it must be closed.
 func (c *Client) Do(method, url string, headers map[string][]string, body io.Reader) (client.Status, map[string][]string, io.ReadCloser, error) {
-	if headers == nil {
-		headers = make(map[string][]string)
+	return c.DoContext(context.Background(), method, url, headers, body)
+}
+
+// DoContext is like Do, but dials using ctx, and calls the client.Trace
+// carried by ctx, if any, as the request progresses. Cancelling ctx interrupts
+// a HTTP/1.x request until its response headers have been read, and a HTTP/2
+// request while it is dialed; it does not interrupt reading the body.
+func (c *Client) DoContext(ctx context.Context, method, url string, headers map[string][]string, body io.Reader) (client.Status, map[string][]string, io.ReadCloser, error) {
+	return c.doLog(ctx, method, url, headers, body)
+}
+
+// doSpan sends a request, started as a span by the Tracer of c, if any, and
+// counted by its Metrics.
+func (c *Client) doSpan(ctx context.Context, method, url string, headers map[string][]string, body io.Reader) (client.Status, map[string][]string, io.ReadCloser, error) {
+	var spans multiSpan
+	if c.Tracer != nil {
+		var span Span
+		ctx, span = c.Tracer.Start(ctx, method, url)
+		spans = append(spans, span)
+	}
+	if c.Metrics != nil {
+		spans = append(spans, c.Metrics.start(c, method, url))
+	}
+	if len(spans) == 0 {
+		return c.do(ctx, method, url, headers, body)
+	}
+	state := new(requestState)
+	status, rheaders, r, err := c.do(context.WithValue(ctx, requestStateKey{}, state), method, url, headers, body)
+	b := &spanBody{ReadCloser: r, span: spans, state: state, info: SpanInfo{Method: method, URL: url, StatusCode: status.Code}}
+	if err != nil {
+		b.end(err)
+		return status, rheaders, r, err
+	}
+	return status, rheaders, b, nil
+}
+
+// do sends a request, following redirects and sending it again as required.
+func (c *Client) do(ctx context.Context, method, url string, headers map[string][]string, body io.Reader) (client.Status, map[string][]string, io.ReadCloser, error) {
+	// headers are added and removed below, so the caller's map is copied.
+	h := make(map[string][]string, len(headers)+3)
+	for k, v := range headers {
+		h[k] = v
 	}
+	headers = h
 	u, err := stdurl.ParseRequestURI(url)
 	if err != nil {
 		return client.Status{}, nil, nil, err
 	}
-	host := u.Host
-	headers["Host"] = []string{host}
-	if !strings.Contains(host, ":") {
-		host += ":80"
+	headers["Host"] = []string{u.Host}
+	host, path, query := target(u)
+	if c.PropagateTraceContext {
+		propagate(ctx, headers)
 	}
-	path := u.Path
-	if path == "" {
-		path = "/"
+	if body != nil && c.ExpectContinue > 0 {
+		headers["Expect"] = []string{"100-continue"}
 	}
-	if u.RawQuery != "" {
-		path += "?" + u.RawQuery
+	decode := !c.DisableDecompression
+	switch ae, ok := header(headers, "Accept-Encoding"); {
+	case !ok && decode:
+		headers["Accept-Encoding"] = []string{acceptEncoding()}
+	case strings.EqualFold(strings.TrimSpace(ae), "identity"):
+		decode = false
 	}
-	conn, err := c.dialer.Dial("tcp", host)
+	length, err := requestLength(headers)
 	if err != nil {
 		return client.Status{}, nil, nil, err
 	}
-	req := toRequest(method, path, nil, headers, body)
-	if err := conn.WriteRequest(req); err != nil {
+	wbody := body
+	encoded, enc, err := c.encodeRequest(headers, body, length)
+	if err != nil {
 		return client.Status{}, nil, nil, err
 	}
-	resp, err := conn.ReadResponse()
+	if enc != nil {
+		// the compressed length is unknown, so the body is sent chunked.
+		defer encoded.Close()
+		defer delete(headers, "Content-Encoding")
+		wbody, length = encoded, -1
+	}
+	req := toRequest(method, path, query, headers, wbody)
+	req.Length = length
+	if l := req.ContentLength(); l != 0 {
+		// the length is found before the body is counted, hiding it.
+		req.Length, req.Body = l, countSent(ctx, req.Body)
+	}
+	req.ContinueTimeout = c.ExpectContinue
+	req.Trace = client.ContextTrace(ctx)
+	resp, closer, err := c.roundTrip(ctx, u.Scheme, host, req)
 	if err != nil {
 		return client.Status{}, nil, nil, err
 	}
 	_, rstatus, rheaders, rbody := fromResponse(resp)
-	if headerValue(rheaders, "Content-Encoding") == "gzip" {
-		rbody, err = gzip.NewReader(rbody)
+	if hasBody(method, rstatus) {
+		rbody, closer = c.limitBody(rheaders, rbody, closer, decode)
+	}
+	rbody, closer = traceBody(req.Trace, rbody, closer)
+	rc := &readCloser{Reader: rbody, Closer: closer}
+	if enc.refused(rstatus.Code, rheaders) {
+		// send the request again, uncompressed.
+		_, err := io.Copy(io.Discard, rc)
+		if err := firstErr(err, rc.Close()); err != nil {
+			return client.Status{}, nil, nil, err
+		}
+		encoded.Close()
+		if err := enc.rewind(); err != nil {
+			return client.Status{}, nil, nil, err
+		}
+		enc.restore(headers)
+		addRetry(ctx)
+		logEvent(ctx, levelWarn, "http request encoding refused, sending uncompressed", "method", method, "url", logURL{url, c.RedactParams}, "encoding", enc.coding)
+		return c.WithRequestEncoding("").do(ctx, method, url, headers, body)
 	}
-	rc := &readCloser{rbody, conn}
 	if rstatus.IsRedirect() && c.FollowRedirects {
 		// consume the response body
 		_, err := io.Copy(io.Discard, rc)
@@ -66,25 +218,270 @@ func (c *Client) Do(method, url string, headers map[string][]string, body io.Rea
 		}
 		loc := headerValue(rheaders, "Location")
 		if strings.HasPrefix(loc, "/") {
-			loc = fmt.Sprintf("http://%s%s", host, loc)
+			loc = fmt.Sprintf("%s://%s%s", u.Scheme, host, loc)
 		}
-		return c.Do(method, loc, headers, body)
+		if enc != nil {
+			enc.restore(headers)
+		}
+		addRedirect(ctx)
+		logEvent(ctx, levelDebug, "http redirect", "method", method, "url", logURL{url, c.RedactParams}, "status", rstatus.Code, "location", logURL{loc, c.RedactParams})
+		return c.do(ctx, method, loc, headers, body)
 	}
+	watch(rc, c.OnLeak, method, url)
 	return rstatus, rheaders, rc, err
 }
 
+// target returns the address to dial for u, adding the default port of its
+// scheme if none is given, and the path and query to request. The query is
+// sent as given.
+func target(u *stdurl.URL) (string, string, []string) {
+	host := u.Host
+	if !strings.Contains(host, ":") {
+		switch u.Scheme {
+		case "http":
+			host += ":80"
+		case "https":
+			host += ":443"
+		}
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var query []string
+	if u.RawQuery != "" {
+		query = []string{u.RawQuery}
+	}
+	return host, path, query
+}
+
+// defaultDialer is used by Clients which were not constructed with a Dialer.
+var defaultDialer = new(dialer)
+
+func (c *Client) dial(ctx context.Context, network, addr string) (Conn, error) {
+	var d Dialer = defaultDialer
+	if c.dialer != nil {
+		d = c.dialer
+	}
+	if cd, ok := d.(contextDialer); ok {
+		return cd.dialContext(ctx, network, addr)
+	}
+	return d.Dial(network, addr)
+}
+
+// roundTrip sends req to addr and reads the response, using HTTP/2 if it is
+// enabled and supported by the server. The returned Closer releases the
+// resources held by the response body.
+func (c *Client) roundTrip(ctx context.Context, scheme, addr string, req *client.Request) (*client.Response, io.Closer, error) {
+	var h2 *http2.Conn
+	var err error
+	switch {
+	case scheme == "https" && c.HTTP2:
+		var td tlsDialer
+		if td, err = c.tlsDialer(scheme); err == nil {
+			var conn Conn
+			if conn, h2, err = td.dialTLS(ctx, addr, c.TLSConfig, true); err == nil && h2 == nil {
+				return c.roundTripHTTP1(ctx, conn, scheme, addr, req)
+			}
+		}
+	case scheme == "http" && c.H2C:
+		var td tlsDialer
+		if td, err = c.tlsDialer(scheme); err == nil {
+			h2, err = td.dialH2C(ctx, addr)
+		}
+	default:
+		var conn Conn
+		if conn, err = c.dialHTTP1(ctx, scheme, addr); err == nil {
+			return c.roundTripHTTP1(ctx, conn, scheme, addr, req)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Version = client.HTTP_2_0
+	resp, err := h2.RoundTrip(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, resp.Body.(io.Closer), nil
+}
+
+// roundTripHTTP1 sends req over conn and reads the response. If conn was
+// taken from the pool and is found to have been closed by the server while
+// idle, a replayable request is sent again on another connection.
+func (c *Client) roundTripHTTP1(ctx context.Context, conn Conn, scheme, addr string, req *client.Request) (*client.Response, io.Closer, error) {
+	for {
+		setTranscript(conn, c.Transcript)
+		stop := interrupt(ctx, conn)
+		resp, wrote, err := sendHTTP1(conn, req)
+		if stop() {
+			conn.Close()
+			return nil, nil, ctx.Err()
+		}
+		if err == nil {
+			b := &connBody{r: resp.Body, conn: conn, reuse: reusable(req, resp), ctx: ctx, pool: poolKey(conn, addr)}
+			if !hasBody(req.Method, resp.Status) {
+				b.r = eofReader{}
+			}
+			resp.Body = b
+			return resp, b, nil
+		}
+		if !reused(conn) || !replayable(req) || !stale(wrote, resp, err) {
+			conn.Close()
+			return nil, nil, err
+		}
+		evict(conn)
+		addRetry(ctx)
+		logEvent(ctx, levelWarn, "http request failed on reused connection, retrying", "pool", poolKey(conn, addr), "error", err)
+		if conn, err = c.dialHTTP1(ctx, scheme, addr); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// sendHTTP1 sends req over conn and reads the final response, skipping any
+// interim 1xx responses other than 101 Switching Protocols, reporting whether
+// the request was written.
+func sendHTTP1(conn Conn, req *client.Request) (*client.Response, bool, error) {
+	if err := conn.WriteRequest(req); err != nil {
+		return nil, false, err
+	}
+	resp, err := conn.ReadResponse()
+	for err == nil && resp.IsInformational() && resp.Code != client.INFO_SWITCHING_PROTOCOL {
+		// an interim response, such as 103 Early Hints, shows the request was
+		// received, so it is kept if the final response cannot be read.
+		interim := resp
+		if resp, err = conn.ReadResponse(); resp == nil {
+			resp = interim
+		}
+	}
+	return resp, true, err
+}
+
+// interrupt ends any write or read blocked on conn if ctx is done before the
+// returned func is called. The func reports whether conn was interrupted, in
+// which case it must be closed.
+func interrupt(ctx context.Context, conn Conn) func() bool {
+	if ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+	return func() bool {
+		close(done)
+		return <-interrupted
+	}
+}
+
+// replayable reports whether req may be sent again after it failed, which is
+// the case if it has no body and is idempotent, by its method or by carrying
+// an Idempotency-Key.
+func replayable(req *client.Request) bool {
+	if req.Body != nil {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	for _, h := range req.Headers {
+		if strings.EqualFold(h.Key, "Idempotency-Key") || strings.EqualFold(h.Key, "X-Idempotency-Key") {
+			return true
+		}
+	}
+	return false
+}
+
+// stale reports whether err, from sending a request on a conn taken from the
+// pool, shows that the server closed the conn while it was idle: the request
+// could not be written, or the conn failed before any of the response, resp,
+// was read, so the server cannot have acted on the request.
+func stale(wrote bool, resp *client.Response, err error) bool {
+	var verr *client.ValidationError
+	if !wrote {
+		// a rejected request is not written, so the conn was not at fault.
+		return !errors.As(err, &verr)
+	}
+	return resp == nil && (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET))
+}
+
+// eofReader is the body of a response which has none.
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+// dialHTTP1 returns a Conn to addr which speaks HTTP/1.1.
+func (c *Client) dialHTTP1(ctx context.Context, scheme, addr string) (Conn, error) {
+	switch scheme {
+	case "http":
+		return c.dial(ctx, "tcp", addr)
+	case "https":
+		td, err := c.tlsDialer(scheme)
+		if err != nil {
+			return nil, err
+		}
+		conn, _, err := td.dialTLS(ctx, addr, c.TLSConfig, false)
+		if err == nil && conn == nil {
+			return nil, errors.New("http: no HTTP/1.1 connection to " + addr)
+		}
+		return conn, err
+	default:
+		return nil, fmt.Errorf("unsupported protocol scheme %q", scheme)
+	}
+}
+
+func (c *Client) tlsDialer(scheme string) (tlsDialer, error) {
+	var d Dialer = defaultDialer
+	if c.dialer != nil {
+		d = c.dialer
+	}
+	td, ok := d.(tlsDialer)
+	if !ok {
+		return nil, fmt.Errorf("Dialer %T does not support %s", d, scheme)
+	}
+	return td, nil
+}
+
 // StatusError reprents a client.Status as an error.
 type StatusError struct {
 	client.Status
+
+	// Headers holds the response headers, if known.
+	Headers map[string][]string
+
+	// Body holds up to the first 8k of the response body, if known.
+	Body []byte
+
+	// Problem, if non nil, is the problem details document carried by the body.
+	Problem *ProblemError
+
+	// JSON, if non nil, is the response body decoded as JSON, as returned by
+	// GetJSON and PostJSON.
+	JSON interface{}
 }
 
 func (s *StatusError) Error() string {
+	if s.Problem != nil {
+		return s.Status.String() + ": " + s.Problem.Error()
+	}
 	return s.Status.String()
 }
 
-type readCloser struct {
-	io.Reader
-	io.Closer
+// Unwrap returns the Problem, if any, so it may be found with errors.As.
+func (s *StatusError) Unwrap() error {
+	if s.Problem == nil {
+		return nil
+	}
+	return s.Problem
 }
 
 // Get sends a GET request. If the response body is non nil it must be closed.
@@ -97,6 +494,17 @@ func (c *Client) Post(url string, headers map[string][]string, body io.Reader) (
 	return c.Do("POST", url, headers, body)
 }
 
+// PostForm sends a POST request with form encoded as an
+// application/x-www-form-urlencoded body.
+func (c *Client) PostForm(url string, headers map[string][]string, form client.Values) (client.Status, map[string][]string, io.ReadCloser, error) {
+	h := make(map[string][]string, len(headers)+1)
+	for k, v := range headers {
+		h[k] = v
+	}
+	h["Content-Type"] = []string{"application/x-www-form-urlencoded"}
+	return c.Do("POST", url, h, strings.NewReader(form.Encode()))
+}
+
 // Put sends a PUT request, suppling the contents of the reader as the request body.
 func (c *Client) Put(url string, headers map[string][]string, body io.Reader) (client.Status, map[string][]string, io.ReadCloser, error) {
 	return c.Do("PUT", url, headers, body)
@@ -123,6 +531,27 @@ func toRequest(method string, path string, query []string, headers map[string][]
 	}
 }
 
+// requestLength removes any Content-Length header from headers, returning its
+// value. The length is carried by client.Request.Length so the header is not sent
+// twice. If headers has no Content-Length, zero is returned.
+func requestLength(headers map[string][]string) (int64, error) {
+	for k, v := range headers {
+		if !strings.EqualFold(k, "Content-Length") {
+			continue
+		}
+		delete(headers, k)
+		if len(v) != 1 {
+			return 0, fmt.Errorf("invalid Content-Length: %q", v)
+		}
+		l, err := strconv.ParseInt(v[0], 10, 64)
+		if err != nil || l < 0 {
+			return 0, fmt.Errorf("invalid Content-Length: %q", v[0])
+		}
+		return l, nil
+	}
+	return 0, nil
+}
+
 func fromResponse(resp *client.Response) (client.Version, client.Status, map[string][]string, io.Reader) {
 	body := resp.Body
 	headers := fromHeaders(resp.Headers)
@@ -150,6 +579,29 @@ func fromHeaders(h []client.Header) map[string][]string {
 	return r
 }
 
+// header returns the values of the header key, matched case insensitively and
+// joined by commas, and whether it was present.
+func header(headers map[string][]string, key string) (string, bool) {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return strings.Join(v, ", "), true
+		}
+	}
+	return "", false
+}
+
+// hasBody reports whether a response with status to a request using method carries a body.
+func hasBody(method string, status client.Status) bool {
+	switch {
+	case strings.EqualFold(method, "HEAD"), status.IsInformational():
+		return false
+	case status.Code == client.SUCCESS_NO_CONTENT, status.Code == client.REDIRECTION_NOT_MODIFIED:
+		return false
+	default:
+		return true
+	}
+}
+
 func headerValue(headers map[string][]string, key string) string {
 	return strings.Join(headers[key], " ")
 }
@@ -0,0 +1,329 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxChunkLine is the longest chunk size line, including any chunk
+	// extensions, the ChunkedReader will accept.
+	maxChunkLine = 4096
+
+	// defaultChunkSize is the largest chunk written by a ChunkedWriter
+	// unless otherwise specified.
+	defaultChunkSize = 32 * 1024
+)
+
+// ChunkError describes a malformed chunked body.
+type ChunkError struct {
+	// Line is the offending chunk size line, if any.
+	Line string
+
+	// Reason describes what was wrong with the chunk.
+	Reason string
+}
+
+func (e *ChunkError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("malformed chunk: %s", e.Reason)
+	}
+	return fmt.Sprintf("malformed chunk: %s: %q", e.Reason, e.Line)
+}
+
+// ChunkExtension represents a chunk extension, rfc 9112 s7.1.1.
+type ChunkExtension struct {
+	Name  string
+	Value string
+}
+
+// ChunkedReader decodes a body sent using chunked transfer coding, rfc 9112 s7.1.
+// The Body of a Response sent with chunked encoding is a *ChunkedReader.
+type ChunkedReader struct {
+	r *bufio.Reader
+
+	// MaxChunkSize, if non zero, is the largest chunk the reader will accept.
+	MaxChunkSize int64
+
+	n          int64 // bytes remaining in the current chunk
+	extensions []ChunkExtension
+	trailers   []Header
+	err        error
+
+	// eof, if non nil, is called once the trailers have been read.
+	eof func()
+}
+
+// NewChunkedReader returns a ChunkedReader which decodes the chunked body read from r.
+func NewChunkedReader(r *bufio.Reader) *ChunkedReader {
+	return &ChunkedReader{r: r}
+}
+
+// Extensions returns the chunk extensions of the chunk currently being read.
+func (c *ChunkedReader) Extensions() []ChunkExtension { return c.extensions }
+
+// Trailers returns the trailer fields which followed the body. It is
+// populated once the body has been read to EOF.
+func (c *ChunkedReader) Trailers() []Header { return c.trailers }
+
+func (c *ChunkedReader) Read(buf []byte) (int, error) {
+	for c.err == nil && c.n == 0 {
+		c.err = c.beginChunk()
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	if int64(len(buf)) > c.n {
+		buf = buf[:c.n]
+	}
+	n, err := c.r.Read(buf)
+	c.n -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && c.n == 0 {
+		err = c.endChunk()
+	}
+	c.err = err
+	return n, err
+}
+
+// beginChunk reads the next chunk size line. If it is the last chunk the
+// trailer section is read and io.EOF returned.
+func (c *ChunkedReader) beginChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	size, ext, err := parseChunkLine(line)
+	if err != nil {
+		return err
+	}
+	if c.MaxChunkSize > 0 && size > c.MaxChunkSize {
+		return &ChunkError{Line: string(line), Reason: fmt.Sprintf("chunk size exceeds maximum of %d", c.MaxChunkSize)}
+	}
+	c.n, c.extensions = size, ext
+	if size > 0 {
+		return nil
+	}
+	if err := c.readTrailers(); err != nil {
+		return err
+	}
+	if c.eof != nil {
+		c.eof()
+	}
+	return io.EOF
+}
+
+// endChunk consumes the CRLF which terminates the chunk data.
+func (c *ChunkedReader) endChunk() error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(c.r, crlf[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return &ChunkError{Reason: fmt.Sprintf("expected CRLF after chunk data, got %q", crlf[:])}
+	}
+	return nil
+}
+
+func (c *ChunkedReader) readTrailers() error {
+	r := reader{c.r}
+	for {
+		key, value, done, err := r.ReadHeader()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if key == "" {
+			return errors.New("invalid trailer")
+		}
+		c.trailers = append(c.trailers, Header{key, value})
+	}
+}
+
+// readLine reads a CRLF terminated chunk size line, returning it without the CRLF.
+func (c *ChunkedReader) readLine() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	switch err {
+	case nil:
+	case io.EOF:
+		return nil, io.ErrUnexpectedEOF
+	case bufio.ErrBufferFull:
+		return nil, &ChunkError{Line: string(line), Reason: "chunk size line too long"}
+	default:
+		return nil, err
+	}
+	if len(line) > maxChunkLine {
+		return nil, &ChunkError{Line: string(line), Reason: "chunk size line too long"}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, &ChunkError{Line: string(line), Reason: "chunk size line not terminated by CRLF"}
+	}
+	return line[:len(line)-2], nil
+}
+
+// parseChunkLine parses a chunk size line, chunk-size [ chunk-ext ].
+func parseChunkLine(line []byte) (int64, []ChunkExtension, error) {
+	i := 0
+	for i < len(line) && isHex(line[i]) {
+		i++
+	}
+	if i == 0 {
+		return 0, nil, &ChunkError{Line: string(line), Reason: "invalid chunk size"}
+	}
+	size, err := strconv.ParseInt(string(line[:i]), 16, 64)
+	if err != nil {
+		return 0, nil, &ChunkError{Line: string(line), Reason: "chunk size out of range"}
+	}
+	ext, err := parseChunkExtensions(line[i:])
+	if err != nil {
+		return 0, nil, &ChunkError{Line: string(line), Reason: err.Error()}
+	}
+	return size, ext, nil
+}
+
+// parseChunkExtensions parses *( BWS ";" BWS chunk-ext-name [ BWS "=" BWS chunk-ext-val ] ).
+func parseChunkExtensions(s []byte) ([]ChunkExtension, error) {
+	var ext []ChunkExtension
+	for {
+		s = trimBWS(s)
+		if len(s) == 0 {
+			return ext, nil
+		}
+		if s[0] != ';' {
+			return nil, fmt.Errorf("unexpected %q in chunk extensions", s[0])
+		}
+		s = trimBWS(s[1:])
+		var e ChunkExtension
+		e.Name, s = token(s)
+		if e.Name == "" {
+			return nil, errors.New("invalid chunk extension name")
+		}
+		s = trimBWS(s)
+		if len(s) > 0 && s[0] == '=' {
+			var err error
+			s = trimBWS(s[1:])
+			if len(s) > 0 && s[0] == '"' {
+				e.Value, s, err = quotedString(s)
+				if err != nil {
+					return nil, err
+				}
+			} else if e.Value, s = token(s); e.Value == "" {
+				return nil, errors.New("invalid chunk extension value")
+			}
+		}
+		ext = append(ext, e)
+	}
+}
+
+func trimBWS(s []byte) []byte { return bytes.TrimLeft(s, " \t") }
+
+// token returns the leading token of s, and the remainder.
+func token(s []byte) (string, []byte) {
+	i := 0
+	for i < len(s) && isTokenChar(s[i]) {
+		i++
+	}
+	return string(s[:i]), s[i:]
+}
+
+// quotedString unquotes the leading quoted-string of s, returning it and the remainder.
+func quotedString(s []byte) (string, []byte, error) {
+	var b []byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return string(b), s[i+1:], nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			b = append(b, s[i])
+		case c == '\t' || c >= 0x20 && c != 0x7f:
+			b = append(b, c)
+		default:
+			return "", nil, fmt.Errorf("invalid character %q in quoted string", c)
+		}
+	}
+	return "", nil, errors.New("unterminated quoted string")
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// ChunkedWriter encodes data written to it using chunked transfer coding, rfc 9112 s7.1.
+// Each Write produces one or more chunks of at most the size given to NewChunkedWriter.
+type ChunkedWriter struct {
+	w    io.Writer
+	size int
+}
+
+// NewChunkedWriter returns a ChunkedWriter which writes chunks of at most size
+// bytes to w. If size is not positive, a default of 32k is used.
+func NewChunkedWriter(w io.Writer, size int) *ChunkedWriter {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	return &ChunkedWriter{w: w, size: size}
+}
+
+func (c *ChunkedWriter) Write(buf []byte) (int, error) {
+	var n int
+	for len(buf) > 0 {
+		chunk := buf
+		if len(chunk) > c.size {
+			chunk = chunk[:c.size]
+		}
+		if _, err := fmt.Fprintf(c.w, "%x\r\n", len(chunk)); err != nil {
+			return n, err
+		}
+		m, err := c.w.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if _, err := io.WriteString(c.w, "\r\n"); err != nil {
+			return n, err
+		}
+		buf = buf[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close writes the last chunk and an empty trailer section.
+func (c *ChunkedWriter) Close() error {
+	return c.CloseWithTrailers(nil)
+}
+
+// CloseWithTrailers writes the last chunk followed by the trailer fields.
+func (c *ChunkedWriter) CloseWithTrailers(trailers []Header) error {
+	// the last chunk and trailer section are buffered, like the headers.
+	bw := bufio.NewWriter(c.w)
+	if _, err := bw.WriteString("0\r\n"); err != nil {
+		return err
+	}
+	for _, h := range trailers {
+		if err := ValidHeader(h.Key, h.Value); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(bw, "%s: %s\r\n", h.Key, h.Value); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.WriteString("\r\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
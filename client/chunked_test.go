@@ -0,0 +1,180 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var chunkedReaderTests = []struct {
+	data     string
+	max      int64
+	expected string
+	trailers []Header
+	err      error
+}{
+	{"0\r\n\r\n", 0, "", nil, nil},
+	{"5\r\nhello\r\n0\r\n\r\n", 0, "hello", nil, nil},
+	{"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n", 0, "hello world", nil, nil},
+	{"A\r\n0123456789\r\n0\r\n\r\n", 0, "0123456789", nil, nil},
+	{"000005\r\nhello\r\n000\r\n\r\n", 0, "hello", nil, nil},
+	{"5;name=value\r\nhello\r\n0\r\n\r\n", 0, "hello", nil, nil},
+	{"5\r\nhello\r\n0\r\nChecksum: 1234\r\n\r\n", 0, "hello", []Header{{"Checksum", "1234"}}, nil},
+	{"5\r\nhello\r\n0\r\n\r\n", 5, "hello", nil, nil},
+	{"", 0, "", nil, io.ErrUnexpectedEOF},
+	{"5\r\nhel", 0, "hel", nil, io.ErrUnexpectedEOF},
+	{"5\r\nhello\r\n", 0, "hello", nil, io.ErrUnexpectedEOF},
+	{"5\r\nhello\r\n0\r\n", 0, "hello", nil, io.ErrUnexpectedEOF},
+	{"5\r\nhello\r\n0\r\nChecksum: 1234\r\n", 0, "hello", []Header{{"Checksum", "1234"}}, io.ErrUnexpectedEOF},
+	{"\r\nhello\r\n0\r\n\r\n", 0, "", nil, errors.New(`malformed chunk: invalid chunk size`)},
+	{"0x5\r\nhello\r\n0\r\n\r\n", 0, "", nil, errors.New(`malformed chunk: unexpected 'x' in chunk extensions: "0x5"`)},
+	{" 5\r\nhello\r\n0\r\n\r\n", 0, "", nil, errors.New(`malformed chunk: invalid chunk size: " 5"`)},
+	{"-5\r\nhello\r\n0\r\n\r\n", 0, "", nil, errors.New(`malformed chunk: invalid chunk size: "-5"`)},
+	{"5\nhello\r\n0\r\n\r\n", 0, "", nil, errors.New(`malformed chunk: chunk size line not terminated by CRLF: "5\n"`)},
+	{"5\r\nhelloXX0\r\n\r\n", 0, "hello", nil, errors.New(`malformed chunk: expected CRLF after chunk data, got "XX"`)},
+	{"10000000000000000\r\n", 0, "", nil, errors.New(`malformed chunk: chunk size out of range: "10000000000000000"`)},
+	{"6\r\nhello!\r\n0\r\n\r\n", 5, "", nil, errors.New(`malformed chunk: chunk size exceeds maximum of 5: "6"`)},
+	{"5;=value\r\nhello\r\n0\r\n\r\n", 0, "", nil, errors.New(`malformed chunk: invalid chunk extension name: "5;=value"`)},
+	{"5;name=\"value\r\nhello\r\n0\r\n\r\n", 0, "", nil, errors.New(`malformed chunk: unterminated quoted string: "5;name=\"value"`)},
+	{"5\r\nhello\r\n0\r\n: empty\r\n\r\n", 0, "hello", nil, errors.New("invalid trailer")},
+}
+
+func TestChunkedReader(t *testing.T) {
+	for _, tt := range chunkedReaderTests {
+		cr := NewChunkedReader(b(tt.data))
+		cr.MaxChunkSize = tt.max
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, cr)
+		if actual := buf.String(); actual != tt.expected || !sameErr(err, tt.err) {
+			t.Errorf("ChunkedReader(%q): expected %q %v, got %q %v", tt.data, tt.expected, tt.err, actual, err)
+		}
+		if !reflect.DeepEqual(cr.Trailers(), tt.trailers) {
+			t.Errorf("ChunkedReader(%q): Trailers: expected %v, got %v", tt.data, tt.trailers, cr.Trailers())
+		}
+	}
+}
+
+func TestChunkedReaderMalformedError(t *testing.T) {
+	_, err := io.ReadAll(NewChunkedReader(b("zz\r\n")))
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("expected %T, got %v", chunkErr, err)
+	}
+	if chunkErr.Line != "zz" {
+		t.Errorf("ChunkError.Line: expected %q, got %q", "zz", chunkErr.Line)
+	}
+}
+
+var chunkExtensionsTests = []struct {
+	line     string
+	expected []ChunkExtension
+}{
+	{"5", nil},
+	{"5;a", []ChunkExtension{{"a", ""}}},
+	{"5;a=b", []ChunkExtension{{"a", "b"}}},
+	{"5 ; a = b ; c", []ChunkExtension{{"a", "b"}, {"c", ""}}},
+	{`5;a="quoted \"value\"";c=d`, []ChunkExtension{{"a", `quoted "value"`}, {"c", "d"}}},
+}
+
+func TestChunkedReaderExtensions(t *testing.T) {
+	for _, tt := range chunkExtensionsTests {
+		cr := NewChunkedReader(b(tt.line + "\r\nhello\r\n0\r\n\r\n"))
+		buf := make([]byte, 2)
+		if _, err := cr.Read(buf); err != nil {
+			t.Fatalf("ChunkedReader(%q): %v", tt.line, err)
+		}
+		if actual := cr.Extensions(); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("ChunkedReader(%q).Extensions(): expected %v, got %v", tt.line, tt.expected, actual)
+		}
+	}
+}
+
+var chunkedWriterTests = []struct {
+	size     int
+	writes   []string
+	trailers []Header
+	expected string
+}{
+	{0, nil, nil, "0\r\n\r\n"},
+	{0, []string{"hello"}, nil, "5\r\nhello\r\n0\r\n\r\n"},
+	{0, []string{"hello", "", " world"}, nil, "5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"},
+	{4, []string{"hello world"}, nil, "4\r\nhell\r\n4\r\no wo\r\n3\r\nrld\r\n0\r\n\r\n"},
+	{5, []string{"hello"}, []Header{{"Checksum", "1234"}}, "5\r\nhello\r\n0\r\nChecksum: 1234\r\n\r\n"},
+	{0, []string{strings.Repeat("a", 16)}, nil, "10\r\n" + strings.Repeat("a", 16) + "\r\n0\r\n\r\n"},
+}
+
+func TestChunkedWriter(t *testing.T) {
+	for _, tt := range chunkedWriterTests {
+		var buf bytes.Buffer
+		cw := NewChunkedWriter(&buf, tt.size)
+		for _, w := range tt.writes {
+			if n, err := cw.Write([]byte(w)); n != len(w) || err != nil {
+				t.Fatalf("ChunkedWriter.Write(%q): expected %d, got %d %v", w, len(w), n, err)
+			}
+		}
+		if err := cw.CloseWithTrailers(tt.trailers); err != nil {
+			t.Fatal(err)
+		}
+		if actual := buf.String(); actual != tt.expected {
+			t.Errorf("ChunkedWriter(%d, %q): expected %q, got %q", tt.size, tt.writes, tt.expected, actual)
+		}
+	}
+}
+
+// a body written by ChunkedWriter can be read by ChunkedReader.
+func TestChunkedRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewChunkedWriter(&buf, 7)
+	body := strings.Repeat("all your base are belong to us", 100)
+	if _, err := io.Copy(cw, strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := io.ReadAll(NewChunkedReader(b(buf.String())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actual) != body {
+		t.Errorf("ChunkedRoundTrip: expected %q, got %q", body, actual)
+	}
+}
+
+func TestClientWriteChunkSize(t *testing.T) {
+	var buf bytes.Buffer
+	client := NewClient(&buf, WriteChunkSize(5))
+	req := Request{
+		Method:  "POST",
+		Path:    "/",
+		Version: HTTP_1_1,
+		Body:    b("Hello world!"),
+	}
+	if err := client.WriteRequest(&req); err != nil {
+		t.Fatal(err)
+	}
+	expected := "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nHello\r\n5\r\n worl\r\n2\r\nd!\r\n0\r\n\r\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("client.WriteRequest(): expected %q, got %q", expected, actual)
+	}
+}
+
+func TestClientMaxReadChunkSize(t *testing.T) {
+	data := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello!\r\n0\r\n\r\n"
+	client := NewClient(&struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(data), io.Discard}, MaxReadChunkSize(5))
+	resp, err := client.ReadResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(resp.Body)
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("expected %T, got %v", chunkErr, err)
+	}
+}
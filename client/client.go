@@ -11,13 +11,14 @@ package client
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"net/http/httputil"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Version represents a HTTP version.
@@ -30,6 +31,7 @@ func (v *Version) String() string { return fmt.Sprintf("HTTP/%d.%d", v.major, v.
 var (
 	HTTP_1_0 = Version{1, 0}
 	HTTP_1_1 = Version{1, 1}
+	HTTP_2_0 = Version{2, 0}
 )
 
 // Header represents a HTTP header.
@@ -48,26 +50,98 @@ type Request struct {
 	Headers []Header
 
 	Body io.Reader
+
+	// Length, if non zero, is the length of Body, overriding the length
+	// ContentLength would otherwise determine. A negative Length marks the
+	// length as unknown, causing the body to be sent using chunked encoding.
+	// A body whose length differs from the length sent fails the request,
+	// and no more than that length is written.
+	Length int64
+
+	// Trailers, if non nil, is called once Body has been written and returns
+	// the trailer fields to send after it. As trailer values may be computed
+	// from the body, for example a checksum, the body is always sent using
+	// chunked encoding. Senders should announce the trailer fields they intend
+	// to send with a Trailer header. Trailers are not supported by HTTP/1.0.
+	Trailers func() []Header
+
+	// ContinueTimeout is the maximum time WriteRequest will wait for the server
+	// to respond to a request carrying an Expect: 100-continue header before
+	// sending the body anyway. If zero, a default of one second is used.
+	ContinueTimeout time.Duration
+
+	// Trace, if non nil, is called as the request is written and its
+	// response read.
+	Trace *Trace
 }
 
-// ContentLength returns the length of the body. If the body length is not known
-// ContentLength will return -1.
+// ExpectContinue reports whether the request carries an Expect: 100-continue header.
+func (r *Request) ExpectContinue() bool {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h.Key, "Expect") {
+			return strings.EqualFold(h.Value, "100-continue")
+		}
+	}
+	return false
+}
+
+// ContentLength returns the length of the body. If Length is non zero it is
+// returned, otherwise the length is determined from Body, which may be anything
+// with a Len() int or Size() int64 method, or a regular file. If the body length
+// is not known ContentLength will return -1.
 func (r *Request) ContentLength() int64 {
-	// TODO(dfc) this should support anything with a Len() int64 method.
 	if r.Body == nil {
 		return -1
 	}
-	switch b := r.Body.(type) {
-	case *bytes.Buffer:
-		return int64(b.Len())
-	case *strings.Reader:
+	if r.Length != 0 {
+		if r.Length < 0 {
+			return -1
+		}
+		return r.Length
+	}
+	return BodyLength(r.Body)
+}
+
+// BodyLength returns the number of bytes remaining in r, or -1 if it cannot be
+// determined. See Request.ContentLength.
+func BodyLength(r io.Reader) int64 {
+	switch b := r.(type) {
+	case interface{ Len() int }:
+		// *bytes.Buffer, *bytes.Reader, *strings.Reader, etc.
 		return int64(b.Len())
+	case *os.File:
+		fi, err := b.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		return remaining(fi.Size(), b)
+	case interface{ Size() int64 }:
+		// *io.SectionReader, etc.
+		return remaining(b.Size(), r)
 	default:
 		return -1
 	}
 }
 
-const readerBuffer = 4096
+// remaining returns the number of bytes between the current offset of r and size.
+// If r is not an io.Seeker, its offset is assumed to be zero.
+func remaining(size int64, r io.Reader) int64 {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return size
+	}
+	off, err := s.Seek(0, io.SeekCurrent)
+	if err != nil || off > size {
+		return -1
+	}
+	return size - off
+}
+
+const (
+	readerBuffer = 4096
+
+	defaultContinueTimeout = 1 * time.Second
+)
 
 // Client represents a single connection to a http server. Client obeys KeepAlive conditions for
 // HTTP but connection pooling is expected to be handled at a higher layer.
@@ -76,21 +150,91 @@ type Client interface {
 	ReadResponse() (*Response, error)
 }
 
+// Option configures a Client returned by NewClient.
+type Option func(*client)
+
+// WriteChunkSize sets the largest chunk the Client will write when sending a
+// request body using chunked encoding. The default is 32k.
+func WriteChunkSize(n int) Option {
+	return func(c *client) { c.writer.chunkSize = n }
+}
+
+// MaxReadChunkSize sets the largest chunk the Client will accept when reading
+// a chunked response body. Larger chunks cause the body to return a *ChunkError.
+// By default the chunk size is not limited.
+func MaxReadChunkSize(n int64) Option {
+	return func(c *client) { c.maxChunkSize = n }
+}
+
 // NewClient returns a Client implementation which uses rw to communicate.
-func NewClient(rw io.ReadWriter) Client {
-	return &client{
-		reader: reader{bufio.NewReaderSize(rw, readerBuffer)},
-		writer: writer{Writer: rw},
+func NewClient(rw io.ReadWriter, options ...Option) Client {
+	c := new(client)
+	c.reader = reader{bufio.NewReaderSize(transcriptReader{rw, &c.transcript}, readerBuffer)}
+	c.transcript.buffered = c.reader.Buffered
+	c.writer = writer{Writer: transcriptWriter{rw, &c.transcript}}
+	for _, option := range options {
+		option(c)
 	}
+	return c
 }
 
 type client struct {
 	reader
 	writer
+
+	maxChunkSize int64 // passed to ChunkedReader.MaxChunkSize.
+
+	// interim, if non nil, receives responses read in the background while
+	// waiting for a 100 Continue. See awaitContinue.
+	interim chan result
+
+	// early holds a final response which arrived before the body was sent.
+	early *result
+
+	mu     sync.Mutex // protects following fields
+	traces []*Trace   // the Traces of the requests written, in order, awaiting responses
+	traced bool       // GotFirstResponseByte has been called for traces[0]
+
+	transcript transcriber
+}
+
+// wroteHeaders calls the WroteHeaders hook of t, if any.
+func wroteHeaders(t *Trace) {
+	if t != nil && t.WroteHeaders != nil {
+		t.WroteHeaders()
+	}
+}
+
+type result struct {
+	*Response
+	err error
 }
 
 // SendRequest marshalls a HTTP request to the wire.
+//
+// If the request carries an Expect: 100-continue header, the body is withheld
+// until the server responds with 100 Continue or ContinueTimeout expires. If the
+// server responds with a final status first, the body is not sent and the
+// response is returned by the next call to ReadResponse. In that case the
+// request is incomplete and the connection should not be reused.
 func (c *client) WriteRequest(req *Request) error {
+	c.mu.Lock()
+	c.traces = append(c.traces, req.Trace)
+	c.mu.Unlock()
+	c.transcript.begin(&c.transcript.send)
+	err := c.writeRequest(req)
+	if t := req.Trace; t != nil && t.WroteRequest != nil {
+		t.WroteRequest(err)
+	}
+	return err
+}
+
+func (c *client) writeRequest(req *Request) error {
+	// nothing is written unless the whole request is valid, so a rejected
+	// request leaves the client ready for the next.
+	if err := ValidRequest(req); err != nil {
+		return err
+	}
 	if err := c.WriteRequestLine(req.Method, req.Path, req.Query, req.Version.String()); err != nil {
 		return err
 	}
@@ -100,6 +244,9 @@ func (c *client) WriteRequest(req *Request) error {
 		}
 	}
 	l := req.ContentLength()
+	if req.Trailers != nil && req.Body != nil {
+		l = -1 // trailers can only be sent with a chunked body.
+	}
 	if l >= 0 {
 		if err := c.WriteHeader("Content-Length", fmt.Sprintf("%d", l)); err != nil {
 			return err
@@ -107,28 +254,123 @@ func (c *client) WriteRequest(req *Request) error {
 	}
 	if req.Body == nil {
 		// doesn't actually start the body, just sends the terminating \r\n
-		return c.StartBody()
+		err := c.StartBody()
+		c.writer.phase = requestline // ready for the next request
+		if err == nil {
+			wroteHeaders(req.Trace)
+		}
+		return err
 	}
 	// TODO(dfc) Version should implement comparable so we can say version >= HTTP_1_1
-	if req.Version.major == 1 && req.Version.minor == 1 {
-		if l < 0 {
-			if err := c.WriteHeader("Transfer-Encoding", "chunked"); err != nil {
-				return err
-			}
-			if err := c.StartBody(); err != nil {
-				return err
-			}
-			return c.WriteChunked(req.Body)
+	chunked := req.Version.major == 1 && req.Version.minor == 1 && l < 0
+	if chunked {
+		if err := c.WriteHeader("Transfer-Encoding", "chunked"); err != nil {
+			return err
 		}
 	}
 	if err := c.StartBody(); err != nil {
 		return err
 	}
+	wroteHeaders(req.Trace)
+	if req.ExpectContinue() && !c.awaitContinue(req.ContinueTimeout, req.Trace) {
+		// the server has answered, abandon the body.
+		c.writer.phase = requestline
+		return nil
+	}
+	if chunked {
+		return c.WriteChunkedTrailers(req.Body, req.Trailers)
+	}
+	if l >= 0 {
+		return c.writeBodyLength(req.Body, l)
+	}
 	return c.WriteBody(req.Body)
 }
 
-// ReadResponse unmarshalls a HTTP response.
+// ValidRequest returns a *ValidationError if the request line or headers of
+// req cannot be sent. WriteRequest calls it before any of req is written; it
+// lets other transports, such as HTTP/2, reject the requests HTTP/1.1 would.
+func ValidRequest(req *Request) error {
+	if err := validRequestLine(req.Method, req.Path, req.Query, req.Version.String()); err != nil {
+		return err
+	}
+	for _, h := range req.Headers {
+		if err := ValidHeader(h.Key, h.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// awaitContinue waits for the server to respond to an Expect: 100-continue
+// request. It reports whether the body should be sent, which is the case if the
+// server responded with 100 Continue or did not respond within timeout.
+//
+// Responses are read in the background until a final response arrives, which
+// ReadResponse will then return.
+func (c *client) awaitContinue(timeout time.Duration, trace *Trace) bool {
+	if timeout <= 0 {
+		timeout = defaultContinueTimeout
+	}
+	// room for a 100 Continue and a final response, so the reader never blocks.
+	interim := make(chan result, 2)
+	go func() {
+		for {
+			resp, err := c.readResponse()
+			if err == nil && resp.IsInformational() {
+				if resp.Code == INFO_CONTINUE && len(interim) == 0 {
+					interim <- result{resp, nil}
+				}
+				continue
+			}
+			interim <- result{resp, err}
+			return
+		}
+	}()
+	c.interim = interim
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case r := <-interim:
+		if r.err == nil && r.Code == INFO_CONTINUE {
+			if trace != nil && trace.Got100Continue != nil {
+				trace.Got100Continue()
+			}
+			return true
+		}
+		c.interim, c.early = nil, &r
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// ReadResponse unmarshalls a HTTP response. If the connection fails before any
+// of the response is read, as when the server closed it while idle, the error
+// wraps that of the connection, such as io.EOF.
 func (c *client) ReadResponse() (*Response, error) {
+	if r := c.early; r != nil {
+		c.early = nil
+		return r.Response, r.err
+	}
+	if c.interim != nil {
+		for r := range c.interim {
+			if r.err == nil && r.IsInformational() {
+				continue // a 100 Continue which arrived after the timeout.
+			}
+			c.interim = nil
+			return r.Response, r.err
+		}
+	}
+	return c.readResponse()
+}
+
+func (c *client) readResponse() (*Response, error) {
+	c.transcript.begin(&c.transcript.recv)
+	defer c.transcript.consumed()
+	if _, err := c.reader.Peek(1); err != nil {
+		return nil, fmt.Errorf("ReadStatusLine: %w", err)
+	}
+	c.gotFirstResponseByte()
 	version, code, msg, err := c.ReadStatusLine()
 	var headers []Header
 	if err != nil {
@@ -154,20 +396,67 @@ func (c *client) ReadResponse() (*Response, error) {
 		Headers: headers,
 		Body:    c.ReadBody(),
 	}
-	if l := resp.ContentLength(); l >= 0 {
+	if !resp.IsInformational() {
+		c.answered()
+	}
+	if resp.Code == INFO_SWITCHING_PROTOCOL {
+		// the connection now speaks another protocol, which may already be buffered.
+		resp.Body = c.reader.Reader
+		c.transcript.switchProtocols()
+	} else if l := resp.ContentLength(); l >= 0 {
 		resp.Body = io.LimitReader(resp.Body, l)
 	} else if resp.TransferEncoding() == "chunked" {
-		resp.Body = httputil.NewChunkedReader(resp.Body)
+		cr := NewChunkedReader(c.reader.Reader)
+		cr.MaxChunkSize = c.maxChunkSize
+		cr.eof = func() { resp.Trailers = cr.Trailers() }
+		resp.Body = cr
+	}
+	if c.transcript.active() && resp.Code != INFO_SWITCHING_PROTOCOL {
+		// the body is recorded as it is read, rather than read ahead.
+		resp.Body = transcriptBody{resp.Body, &c.transcript}
 	}
 	return &resp, err
 }
 
+// gotFirstResponseByte calls the GotFirstResponseByte hook of the earliest
+// request awaiting a response, if it has not already been called.
+func (c *client) gotFirstResponseByte() {
+	c.mu.Lock()
+	var t *Trace
+	if len(c.traces) > 0 && !c.traced {
+		t, c.traced = c.traces[0], true
+	}
+	c.mu.Unlock()
+	if t != nil && t.GotFirstResponseByte != nil {
+		t.GotFirstResponseByte()
+	}
+}
+
+// answered removes the Trace of the earliest request awaiting a response,
+// once its final response has been read.
+func (c *client) answered() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.traces) > 0 {
+		c.traces[0] = nil
+		c.traces, c.traced = c.traces[1:], false
+	}
+}
+
 // Response represents an RFC2616 response.
 type Response struct {
 	Version
 	Status
 	Headers []Header
-	Body    io.Reader
+
+	// Body is the response body. After a 101 Switching Protocols response it
+	// is the *bufio.Reader of the connection, from which data sent by the
+	// server using the new protocol should be read.
+	Body io.Reader
+
+	// Trailers holds the trailer fields which followed a chunked body.
+	// It is populated once Body has been read to EOF.
+	Trailers []Header
 }
 
 // ContentLength returns the length of the body. If the body length is not known
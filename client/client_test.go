@@ -5,9 +5,13 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"net"
+	"net/http"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // assert that client.client implements client.Client
@@ -56,7 +60,7 @@ var sendRequestTests = []struct {
 			// empty body, without len
 			Body: b(""),
 		},
-		"GET / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n",
+		"GET / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
 	},
 	{
 		Request{
@@ -94,7 +98,7 @@ var sendRequestTests = []struct {
 			Version: HTTP_1_1,
 			Body:    b("Hello world!"),
 		},
-		"GET / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nc\r\nHello world!\r\n0\r\n",
+		"GET / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nc\r\nHello world!\r\n0\r\n\r\n",
 	},
 	{
 		Request{
@@ -135,6 +139,18 @@ var sendRequestTests = []struct {
 		},
 		"POST /foo HTTP/1.0\r\nContent-Length: 5\r\n\r\nhello",
 	},
+	{
+		Request{
+			Method:  "POST",
+			Path:    "/foo",
+			Version: HTTP_1_1,
+			Headers: []Header{{"Trailer", "Checksum"}},
+			// known length, but trailers force chunked encoding
+			Body:     strings.NewReader("hello"),
+			Trailers: func() []Header { return []Header{{"Checksum", "1234"}} },
+		},
+		"POST /foo HTTP/1.1\r\nTrailer: Checksum\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\nChecksum: 1234\r\n\r\n",
+	},
 }
 
 func TestClientSendRequest(t *testing.T) {
@@ -302,6 +318,45 @@ func TestClientReadResponse(t *testing.T) {
 	}
 }
 
+var responseTrailersTests = []struct {
+	data     string
+	body     string
+	expected []Header
+}{
+	{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", "hello", nil},
+	{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", "hello", nil},
+	{
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: Checksum\r\n\r\n5\r\nhello\r\n0\r\nChecksum: 1234\r\n\r\n",
+		"hello",
+		[]Header{{"Checksum", "1234"}},
+	},
+	{
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nExpires: never\r\nChecksum: 1234\r\n\r\n",
+		"",
+		[]Header{{"Expires", "never"}, {"Checksum", "1234"}},
+	},
+}
+
+func TestResponseTrailers(t *testing.T) {
+	for _, tt := range responseTrailersTests {
+		client := &client{reader: reader{b(tt.data)}}
+		resp, err := client.ReadResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("ReadResponse(%q): %v", tt.data, err)
+		}
+		if actual := string(body); actual != tt.body {
+			t.Errorf("ReadResponse(%q): Body: expected %q, got %q", tt.data, tt.body, actual)
+		}
+		if !reflect.DeepEqual(resp.Trailers, tt.expected) {
+			t.Errorf("ReadResponse(%q): Trailers: expected %v, got %v", tt.data, tt.expected, resp.Trailers)
+		}
+	}
+}
+
 var responseContentLengthTests = []struct {
 	data     string
 	expected int64
@@ -400,6 +455,20 @@ var requestContentLengthTests = []struct {
 	{Request{Body: nil}, -1},
 	{Request{Body: bytes.NewBuffer([]byte("hello world"))}, 11},
 	{Request{Body: strings.NewReader("hello world")}, 11},
+	{Request{Body: bytes.NewReader([]byte("hello world"))}, 11},
+	{Request{Body: io.NewSectionReader(strings.NewReader("hello world"), 6, 5)}, 5},
+	{Request{Body: seeked(io.NewSectionReader(strings.NewReader("hello world"), 0, 11), 6)}, 5},
+	{Request{Body: b("hello world")}, -1},
+	{Request{Body: b("hello world"), Length: 11}, 11},
+	{Request{Body: strings.NewReader("hello world"), Length: -1}, -1},
+	{Request{Length: 11}, -1},
+}
+
+func seeked(s io.ReadSeeker, off int64) io.Reader {
+	if _, err := s.Seek(off, io.SeekStart); err != nil {
+		panic(err)
+	}
+	return s
 }
 
 func TestRequestContentLength(t *testing.T) {
@@ -410,3 +479,190 @@ func TestRequestContentLength(t *testing.T) {
 		}
 	}
 }
+
+// expectContinueServer reads a single request from conn and answers it
+// according to script, sending the body received on the returned channel.
+func expectContinueServer(t *testing.T, conn net.Conn, script func(*bufio.Reader, net.Conn) string) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			t.Error(err)
+			received <- ""
+			return
+		}
+		if expect := req.Header.Get("Expect"); expect != "100-continue" {
+			t.Errorf("Expect: expected %q, got %q", "100-continue", expect)
+		}
+		received <- script(br, conn)
+	}()
+	return received
+}
+
+var expectContinueTests = []struct {
+	name    string
+	timeout time.Duration
+	// script is run by the server after reading the request headers.
+	script func(*bufio.Reader, net.Conn) string
+	// body is the body the server is expected to have received.
+	body string
+	code int
+}{
+	{
+		name: "continue",
+		script: func(br *bufio.Reader, conn net.Conn) string {
+			io.WriteString(conn, "HTTP/1.1 100 Continue\r\n\r\n")
+			body := make([]byte, len("Hello world!"))
+			io.ReadFull(br, body)
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+			return string(body)
+		},
+		body: "Hello world!",
+		code: 200,
+	},
+	{
+		name: "rejected",
+		script: func(br *bufio.Reader, conn net.Conn) string {
+			io.WriteString(conn, "HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\n\r\n")
+			conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			body, _ := io.ReadAll(br)
+			return string(body)
+		},
+		body: "",
+		code: 401,
+	},
+	{
+		name:    "timeout",
+		timeout: 10 * time.Millisecond,
+		script: func(br *bufio.Reader, conn net.Conn) string {
+			body := make([]byte, len("Hello world!"))
+			io.ReadFull(br, body)
+			io.WriteString(conn, "HTTP/1.1 100 Continue\r\n\r\n")
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+			return string(body)
+		},
+		body: "Hello world!",
+		code: 200,
+	},
+}
+
+func TestClientExpectContinue(t *testing.T) {
+	for _, tt := range expectContinueTests {
+		c, s := net.Pipe()
+		received := expectContinueServer(t, s, tt.script)
+		client := NewClient(c)
+		req := Request{
+			Method:          "PUT",
+			Path:            "/",
+			Version:         HTTP_1_1,
+			Headers:         []Header{{"Expect", "100-continue"}},
+			Body:            strings.NewReader("Hello world!"),
+			ContinueTimeout: tt.timeout,
+		}
+		if err := client.WriteRequest(&req); err != nil {
+			t.Fatalf("%s: client.WriteRequest(): %v", tt.name, err)
+		}
+		resp, err := client.ReadResponse()
+		if err != nil {
+			t.Fatalf("%s: client.ReadResponse(): %v", tt.name, err)
+		}
+		if resp.Code != tt.code {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.code, resp.Code)
+		}
+		if actual := <-received; actual != tt.body {
+			t.Errorf("%s: expected server to receive %q, got %q", tt.name, tt.body, actual)
+		}
+		c.Close()
+	}
+}
+
+var expectContinueRequestTests = []struct {
+	headers  []Header
+	expected bool
+}{
+	{nil, false},
+	{[]Header{{"Host", "localhost"}}, false},
+	{[]Header{{"Expect", "100-continue"}}, true},
+	{[]Header{{"expect", "100-Continue"}}, true},
+	{[]Header{{"Expect", "something-else"}}, false},
+}
+
+func TestRequestExpectContinue(t *testing.T) {
+	for _, tt := range expectContinueRequestTests {
+		req := Request{Headers: tt.headers}
+		if actual := req.ExpectContinue(); actual != tt.expected {
+			t.Errorf("Request{Headers: %v}.ExpectContinue(): expected %v, got %v", tt.headers, tt.expected, actual)
+		}
+	}
+}
+
+func TestRequestContentLengthFile(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("hello world"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	req := Request{Body: f}
+	if actual := req.ContentLength(); actual != 5 {
+		t.Errorf("Request.ContentLength: expected %d, got %d", 5, actual)
+	}
+
+	// pipes are not regular files, their length is unknown.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	req = Request{Body: r}
+	if actual := req.ContentLength(); actual != -1 {
+		t.Errorf("Request.ContentLength: expected %d, got %d", -1, actual)
+	}
+}
+
+// a Client can write consecutive requests without a body.
+func TestClientWriteRequestTwice(t *testing.T) {
+	var b bytes.Buffer
+	client := NewClient(&b)
+	for i := 0; i < 2; i++ {
+		req := Request{Method: "GET", Path: "/", Version: HTTP_1_1}
+		if err := client.WriteRequest(&req); err != nil {
+			t.Fatalf("client.WriteRequest() %d: %v", i, err)
+		}
+	}
+	expected := "GET / HTTP/1.1\r\n\r\nGET / HTTP/1.1\r\n\r\n"
+	if actual := b.String(); actual != expected {
+		t.Errorf("client.WriteRequest(): expected %q, got %q", expected, actual)
+	}
+}
+
+var lengthMismatchTests = []struct {
+	body     string
+	expected string
+}{
+	// no more than Length bytes are written, so the rest cannot be read as another request.
+	{"hello\r\n\r\nGET /evil HTTP/1.1\r\n\r\n", "POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"},
+	{"hel", "POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhel"},
+}
+
+func TestClientWriteRequestLengthMismatch(t *testing.T) {
+	for _, tt := range lengthMismatchTests {
+		var b bytes.Buffer
+		client := NewClient(&b)
+		req := Request{Method: "POST", Path: "/", Version: HTTP_1_1, Body: struct{ io.Reader }{strings.NewReader(tt.body)}, Length: 5}
+		if err := client.WriteRequest(&req); err == nil {
+			t.Errorf("client.WriteRequest(%q): expected error", tt.body)
+		}
+		if actual := b.String(); actual != tt.expected {
+			t.Errorf("client.WriteRequest(%q): expected %q, got %q", tt.body, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package http2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FrameType identifies the type of a frame, rfc 7540 s6.
+type FrameType uint8
+
+const (
+	FrameData         FrameType = 0x0
+	FrameHeaders      FrameType = 0x1
+	FramePriority     FrameType = 0x2
+	FrameRSTStream    FrameType = 0x3
+	FrameSettings     FrameType = 0x4
+	FramePushPromise  FrameType = 0x5
+	FramePing         FrameType = 0x6
+	FrameGoAway       FrameType = 0x7
+	FrameWindowUpdate FrameType = 0x8
+	FrameContinuation FrameType = 0x9
+)
+
+var frameNames = map[FrameType]string{
+	FrameData:         "DATA",
+	FrameHeaders:      "HEADERS",
+	FramePriority:     "PRIORITY",
+	FrameRSTStream:    "RST_STREAM",
+	FrameSettings:     "SETTINGS",
+	FramePushPromise:  "PUSH_PROMISE",
+	FramePing:         "PING",
+	FrameGoAway:       "GOAWAY",
+	FrameWindowUpdate: "WINDOW_UPDATE",
+	FrameContinuation: "CONTINUATION",
+}
+
+func (t FrameType) String() string {
+	if name, ok := frameNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_FRAME_TYPE_%d", uint8(t))
+}
+
+// Flags are the flags of a frame. Their meaning depends on the frame type.
+type Flags uint8
+
+const (
+	FlagEndStream  Flags = 0x1 // DATA, HEADERS
+	FlagAck        Flags = 0x1 // SETTINGS, PING
+	FlagEndHeaders Flags = 0x4 // HEADERS, PUSH_PROMISE, CONTINUATION
+	FlagPadded     Flags = 0x8 // DATA, HEADERS, PUSH_PROMISE
+	FlagPriority   Flags = 0x20
+)
+
+// Has reports whether f contains all of the flags in v.
+func (f Flags) Has(v Flags) bool { return f&v == v }
+
+// SettingID identifies a setting carried by a SETTINGS frame, rfc 7540 s6.5.2.
+type SettingID uint16
+
+const (
+	SettingHeaderTableSize      SettingID = 0x1
+	SettingEnablePush           SettingID = 0x2
+	SettingMaxConcurrentStreams SettingID = 0x3
+	SettingInitialWindowSize    SettingID = 0x4
+	SettingMaxFrameSize         SettingID = 0x5
+	SettingMaxHeaderListSize    SettingID = 0x6
+)
+
+// Setting is a single setting carried by a SETTINGS frame.
+type Setting struct {
+	ID    SettingID
+	Value uint32
+}
+
+// ErrCode is the error code carried by RST_STREAM and GOAWAY frames, rfc 7540 s7.
+type ErrCode uint32
+
+const (
+	ErrCodeNo                 ErrCode = 0x0
+	ErrCodeProtocol           ErrCode = 0x1
+	ErrCodeInternal           ErrCode = 0x2
+	ErrCodeFlowControl        ErrCode = 0x3
+	ErrCodeSettingsTimeout    ErrCode = 0x4
+	ErrCodeStreamClosed       ErrCode = 0x5
+	ErrCodeFrameSize          ErrCode = 0x6
+	ErrCodeRefusedStream      ErrCode = 0x7
+	ErrCodeCancel             ErrCode = 0x8
+	ErrCodeCompression        ErrCode = 0x9
+	ErrCodeConnect            ErrCode = 0xa
+	ErrCodeEnhanceYourCalm    ErrCode = 0xb
+	ErrCodeInadequateSecurity ErrCode = 0xc
+	ErrCodeHTTP11Required     ErrCode = 0xd
+)
+
+var errCodeNames = []string{
+	"NO_ERROR",
+	"PROTOCOL_ERROR",
+	"INTERNAL_ERROR",
+	"FLOW_CONTROL_ERROR",
+	"SETTINGS_TIMEOUT",
+	"STREAM_CLOSED",
+	"FRAME_SIZE_ERROR",
+	"REFUSED_STREAM",
+	"CANCEL",
+	"COMPRESSION_ERROR",
+	"CONNECT_ERROR",
+	"ENHANCE_YOUR_CALM",
+	"INADEQUATE_SECURITY",
+	"HTTP_1_1_REQUIRED",
+}
+
+func (e ErrCode) String() string {
+	if int(e) < len(errCodeNames) {
+		return errCodeNames[e]
+	}
+	return fmt.Sprintf("UNKNOWN_ERROR_%d", uint32(e))
+}
+
+const (
+	// frameHeaderLen is the length of the fixed frame header, rfc 7540 s4.1.
+	frameHeaderLen = 9
+
+	// defaultMaxFrameSize is the initial value of SETTINGS_MAX_FRAME_SIZE.
+	defaultMaxFrameSize = 16384
+
+	// maxFrameSizeLimit is the largest value SETTINGS_MAX_FRAME_SIZE may take.
+	maxFrameSizeLimit = 1<<24 - 1
+
+	// maxWindow is the largest flow control window, rfc 7540 s6.9.1.
+	maxWindow = 1<<31 - 1
+)
+
+// FrameHeader is the fixed header which precedes every frame, rfc 7540 s4.1.
+type FrameHeader struct {
+	Length   uint32
+	Type     FrameType
+	Flags    Flags
+	StreamID uint32
+}
+
+func (h FrameHeader) String() string {
+	return fmt.Sprintf("%v flags=%#x stream=%d len=%d", h.Type, uint8(h.Flags), h.StreamID, h.Length)
+}
+
+// Frame is a single HTTP/2 frame.
+type Frame struct {
+	FrameHeader
+
+	// Payload is the frame payload, including any padding. It is only valid
+	// until the next call to ReadFrame.
+	Payload []byte
+}
+
+// Data returns the payload of a DATA, HEADERS or PUSH_PROMISE frame with any
+// padding removed, rfc 7540 s6.1.
+func (f *Frame) Data() ([]byte, error) {
+	p := f.Payload
+	if !f.Flags.Has(FlagPadded) || f.Type != FrameData && f.Type != FrameHeaders && f.Type != FramePushPromise {
+		return p, nil
+	}
+	if len(p) == 0 || int(p[0]) >= len(p) {
+		return nil, connError{ErrCodeProtocol, fmt.Sprintf("%v frame padding exceeds payload", f.Type)}
+	}
+	return p[1 : len(p)-int(p[0])], nil
+}
+
+// Settings returns the settings carried by a SETTINGS frame.
+func (f *Frame) Settings() ([]Setting, error) {
+	if len(f.Payload)%6 != 0 {
+		return nil, connError{ErrCodeFrameSize, "SETTINGS frame length not a multiple of 6"}
+	}
+	var s []Setting
+	for p := f.Payload; len(p) > 0; p = p[6:] {
+		s = append(s, Setting{SettingID(binary.BigEndian.Uint16(p)), binary.BigEndian.Uint32(p[2:])})
+	}
+	return s, nil
+}
+
+// Framer reads and writes HTTP/2 frames. A Framer is not safe for concurrent
+// use, though reads may proceed concurrently with writes.
+type Framer struct {
+	r    io.Reader
+	w    io.Writer
+	rbuf []byte
+	wbuf []byte
+
+	// MaxReadFrameSize is the largest frame payload ReadFrame will accept. If
+	// zero, the default of 16k is used.
+	MaxReadFrameSize uint32
+}
+
+// NewFramer returns a Framer which writes frames to w and reads them from r.
+func NewFramer(w io.Writer, r io.Reader) *Framer {
+	return &Framer{r: r, w: w}
+}
+
+// ReadFrame reads the next frame.
+func (fr *Framer) ReadFrame() (*Frame, error) {
+	var hdr [frameHeaderLen]byte
+	if _, err := io.ReadFull(fr.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	f := &Frame{FrameHeader: FrameHeader{
+		Length:   uint32(hdr[0])<<16 | uint32(hdr[1])<<8 | uint32(hdr[2]),
+		Type:     FrameType(hdr[3]),
+		Flags:    Flags(hdr[4]),
+		StreamID: binary.BigEndian.Uint32(hdr[5:]) & (1<<31 - 1),
+	}}
+	max := fr.MaxReadFrameSize
+	if max == 0 {
+		max = defaultMaxFrameSize
+	}
+	if f.Length > max {
+		return nil, connError{ErrCodeFrameSize, fmt.Sprintf("%v frame of %d bytes exceeds maximum of %d", f.Type, f.Length, max)}
+	}
+	if cap(fr.rbuf) < int(f.Length) {
+		fr.rbuf = make([]byte, f.Length)
+	}
+	f.Payload = fr.rbuf[:f.Length]
+	if _, err := io.ReadFull(fr.r, f.Payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// WriteFrame writes a frame with the given header fields and payload.
+func (fr *Framer) WriteFrame(t FrameType, flags Flags, streamID uint32, payload []byte) error {
+	if len(payload) > maxFrameSizeLimit {
+		return fmt.Errorf("http2: %v frame payload of %d bytes too large", t, len(payload))
+	}
+	l := len(payload)
+	fr.wbuf = append(fr.wbuf[:0], byte(l>>16), byte(l>>8), byte(l), byte(t), byte(flags))
+	fr.wbuf = binary.BigEndian.AppendUint32(fr.wbuf, streamID&(1<<31-1))
+	fr.wbuf = append(fr.wbuf, payload...)
+	_, err := fr.w.Write(fr.wbuf)
+	return err
+}
+
+// WriteSettings writes a SETTINGS frame carrying settings.
+func (fr *Framer) WriteSettings(settings ...Setting) error {
+	var p []byte
+	for _, s := range settings {
+		p = binary.BigEndian.AppendUint16(p, uint16(s.ID))
+		p = binary.BigEndian.AppendUint32(p, s.Value)
+	}
+	return fr.WriteFrame(FrameSettings, 0, 0, p)
+}
+
+// WriteSettingsAck acknowledges the peer's SETTINGS.
+func (fr *Framer) WriteSettingsAck() error {
+	return fr.WriteFrame(FrameSettings, FlagAck, 0, nil)
+}
+
+// WritePing writes a PING frame. If ack is set, it answers a PING from the peer.
+func (fr *Framer) WritePing(ack bool, data [8]byte) error {
+	var flags Flags
+	if ack {
+		flags = FlagAck
+	}
+	return fr.WriteFrame(FramePing, flags, 0, data[:])
+}
+
+// WriteWindowUpdate increments the flow control window of the stream, or the
+// connection if streamID is zero, by incr.
+func (fr *Framer) WriteWindowUpdate(streamID, incr uint32) error {
+	return fr.WriteFrame(FrameWindowUpdate, 0, streamID, binary.BigEndian.AppendUint32(nil, incr))
+}
+
+// WriteRSTStream abruptly terminates a stream.
+func (fr *Framer) WriteRSTStream(streamID uint32, code ErrCode) error {
+	return fr.WriteFrame(FrameRSTStream, 0, streamID, binary.BigEndian.AppendUint32(nil, uint32(code)))
+}
+
+// WriteGoAway initiates the shutdown of the connection.
+func (fr *Framer) WriteGoAway(lastStreamID uint32, code ErrCode, debug []byte) error {
+	p := binary.BigEndian.AppendUint32(nil, lastStreamID)
+	p = binary.BigEndian.AppendUint32(p, uint32(code))
+	return fr.WriteFrame(FrameGoAway, 0, 0, append(p, debug...))
+}
+
+// connError is a connection error, rfc 7540 s5.4.1. The connection is closed
+// with a GOAWAY frame carrying Code.
+type connError struct {
+	Code   ErrCode
+	Reason string
+}
+
+func (e connError) Error() string {
+	return fmt.Sprintf("http2: connection error: %v: %s", e.Code, e.Reason)
+}
+
+// StreamError is returned when the server resets a stream, rfc 7540 s5.4.2.
+type StreamError struct {
+	StreamID uint32
+	Code     ErrCode
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("http2: stream %d reset: %v", e.StreamID, e.Code)
+}
+
+// GoAwayError is returned for requests the server will not process because
+// it is shutting down the connection, rfc 7540 s6.8. Such requests may be
+// retried on a new connection.
+type GoAwayError struct {
+	LastStreamID uint32
+	Code         ErrCode
+	Debug        string
+}
+
+func (e *GoAwayError) Error() string {
+	if e.Debug == "" {
+		return fmt.Sprintf("http2: server sent GOAWAY: %v", e.Code)
+	}
+	return fmt.Sprintf("http2: server sent GOAWAY: %v: %q", e.Code, e.Debug)
+}
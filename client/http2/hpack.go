@@ -0,0 +1,351 @@
+package http2
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/http/client"
+)
+
+// headerField is an entry in the HPACK static or dynamic table, rfc 7541 s2.3.
+type headerField struct {
+	name, value string
+}
+
+// size returns the size of the entry for the purpose of the table size limit, rfc 7541 s4.1.
+func (f headerField) size() int { return len(f.name) + len(f.value) + 32 }
+
+// staticTable is the HPACK static table, rfc 7541 appendix A. Index 1 is staticTable[0].
+var staticTable = [...]headerField{
+	{":authority", ""},
+	{":method", "GET"},
+	{":method", "POST"},
+	{":path", "/"},
+	{":path", "/index.html"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "200"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "304"},
+	{":status", "400"},
+	{":status", "404"},
+	{":status", "500"},
+	{"accept-charset", ""},
+	{"accept-encoding", "gzip, deflate"},
+	{"accept-language", ""},
+	{"accept-ranges", ""},
+	{"accept", ""},
+	{"access-control-allow-origin", ""},
+	{"age", ""},
+	{"allow", ""},
+	{"authorization", ""},
+	{"cache-control", ""},
+	{"content-disposition", ""},
+	{"content-encoding", ""},
+	{"content-language", ""},
+	{"content-length", ""},
+	{"content-location", ""},
+	{"content-range", ""},
+	{"content-type", ""},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"expect", ""},
+	{"expires", ""},
+	{"from", ""},
+	{"host", ""},
+	{"if-match", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"if-range", ""},
+	{"if-unmodified-since", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"max-forwards", ""},
+	{"proxy-authenticate", ""},
+	{"proxy-authorization", ""},
+	{"range", ""},
+	{"referer", ""},
+	{"refresh", ""},
+	{"retry-after", ""},
+	{"server", ""},
+	{"set-cookie", ""},
+	{"strict-transport-security", ""},
+	{"transfer-encoding", ""},
+	{"user-agent", ""},
+	{"vary", ""},
+	{"via", ""},
+	{"www-authenticate", ""},
+}
+
+// staticIndex maps name and name+value pairs to their lowest index in the static table.
+var staticIndex = func() map[headerField]int {
+	m := make(map[headerField]int)
+	for i := len(staticTable) - 1; i >= 0; i-- {
+		f := staticTable[i]
+		m[f] = i + 1
+		m[headerField{name: f.name}] = i + 1
+	}
+	return m
+}()
+
+// DecodingError is returned when a header block cannot be decoded. It is a
+// connection error of type COMPRESSION_ERROR, rfc 7540 s4.3.
+type DecodingError struct {
+	Err error
+}
+
+func (e *DecodingError) Error() string { return fmt.Sprintf("hpack: decoding error: %v", e.Err) }
+
+func (e *DecodingError) Unwrap() error { return e.Err }
+
+var errHeaderListTooLarge = errors.New("header list too large")
+
+// decoder decodes HPACK header blocks, rfc 7541. It maintains the dynamic
+// table shared by all header blocks received on a connection.
+type decoder struct {
+	dynamic []headerField // most recently added first
+	size    int           // sum of the sizes of the entries in dynamic
+	maxSize int           // current maximum size of the dynamic table
+	limit   int           // the maximum size the encoder may choose, SETTINGS_HEADER_TABLE_SIZE
+
+	// maxListSize, if non zero, limits the decoded size of a header list.
+	maxListSize int
+}
+
+func newDecoder(limit int) *decoder {
+	return &decoder{maxSize: limit, limit: limit}
+}
+
+// decode decodes a complete header block.
+func (d *decoder) decode(block []byte) ([]client.Header, error) {
+	headers, err := d.decodeBlock(block)
+	if err != nil {
+		return nil, &DecodingError{err}
+	}
+	return headers, nil
+}
+
+func (d *decoder) decodeBlock(b []byte) ([]client.Header, error) {
+	var headers []client.Header
+	var listSize int
+	first := true // dynamic table size updates must occur at the start of a block
+	for len(b) > 0 {
+		var f headerField
+		var err error
+		switch c := b[0]; {
+		case c&0x80 != 0:
+			// indexed header field, rfc 7541 s6.1.
+			var i uint64
+			if i, b, err = readInt(b, 7); err != nil {
+				return nil, err
+			}
+			if f, err = d.at(i); err != nil {
+				return nil, err
+			}
+		case c&0xc0 == 0x40:
+			// literal header field with incremental indexing, rfc 7541 s6.2.1.
+			if f, b, err = d.readLiteral(b, 6); err != nil {
+				return nil, err
+			}
+			d.add(f)
+		case c&0xe0 == 0x20:
+			// dynamic table size update, rfc 7541 s6.3.
+			if !first {
+				return nil, errors.New("dynamic table size update after header field")
+			}
+			var size uint64
+			if size, b, err = readInt(b, 5); err != nil {
+				return nil, err
+			}
+			if size > uint64(d.limit) {
+				return nil, fmt.Errorf("dynamic table size update %d exceeds limit %d", size, d.limit)
+			}
+			d.maxSize = int(size)
+			d.evict()
+			continue
+		default:
+			// literal header field without indexing or never indexed, rfc 7541 s6.2.2, s6.2.3.
+			if f, b, err = d.readLiteral(b, 4); err != nil {
+				return nil, err
+			}
+		}
+		first = false
+		listSize += f.size()
+		if d.maxListSize > 0 && listSize > d.maxListSize {
+			return nil, errHeaderListTooLarge
+		}
+		headers = append(headers, client.Header{Key: f.name, Value: f.value})
+	}
+	return headers, nil
+}
+
+// at returns the table entry at index i, rfc 7541 s2.3.3.
+func (d *decoder) at(i uint64) (headerField, error) {
+	switch {
+	case i == 0:
+		return headerField{}, errors.New("invalid index 0")
+	case i <= uint64(len(staticTable)):
+		return staticTable[i-1], nil
+	case i-uint64(len(staticTable)) <= uint64(len(d.dynamic)):
+		return d.dynamic[i-uint64(len(staticTable))-1], nil
+	default:
+		return headerField{}, fmt.Errorf("invalid index %d", i)
+	}
+}
+
+// readLiteral reads a literal header field representation whose name index
+// is an n bit prefix integer.
+func (d *decoder) readLiteral(b []byte, n uint) (headerField, []byte, error) {
+	var f headerField
+	i, b, err := readInt(b, n)
+	if err != nil {
+		return f, nil, err
+	}
+	if i == 0 {
+		if f.name, b, err = readString(b); err != nil {
+			return f, nil, err
+		}
+	} else {
+		indexed, err := d.at(i)
+		if err != nil {
+			return f, nil, err
+		}
+		f.name = indexed.name
+	}
+	f.value, b, err = readString(b)
+	return f, b, err
+}
+
+// add inserts f into the dynamic table, evicting older entries as required, rfc 7541 s4.4.
+func (d *decoder) add(f headerField) {
+	if f.size() > d.maxSize {
+		d.dynamic, d.size = nil, 0
+		return
+	}
+	d.dynamic = append([]headerField{f}, d.dynamic...)
+	d.size += f.size()
+	d.evict()
+}
+
+// evict removes the oldest entries until the dynamic table fits within maxSize.
+func (d *decoder) evict() {
+	for d.size > d.maxSize {
+		last := d.dynamic[len(d.dynamic)-1]
+		d.dynamic = d.dynamic[:len(d.dynamic)-1]
+		d.size -= last.size()
+	}
+}
+
+// readInt reads an integer with an n bit prefix, rfc 7541 s5.1.
+func readInt(b []byte, n uint) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, errors.New("truncated integer")
+	}
+	mask := uint64(1)<<n - 1
+	i := uint64(b[0]) & mask
+	b = b[1:]
+	if i < mask {
+		return i, b, nil
+	}
+	var m uint
+	for len(b) > 0 {
+		c := b[0]
+		b = b[1:]
+		i += uint64(c&0x7f) << m
+		if c&0x80 == 0 {
+			return i, b, nil
+		}
+		m += 7
+		if m >= 63 {
+			return 0, nil, errors.New("integer overflow")
+		}
+	}
+	return 0, nil, errors.New("truncated integer")
+}
+
+// readString reads a string literal, rfc 7541 s5.2.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, errors.New("truncated string")
+	}
+	huffman := b[0]&0x80 != 0
+	l, b, err := readInt(b, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(b)) < l {
+		return "", nil, errors.New("truncated string")
+	}
+	s, b := b[:l], b[l:]
+	if !huffman {
+		return string(s), b, nil
+	}
+	d, err := huffmanDecode(s)
+	return string(d), b, err
+}
+
+// sensitiveHeaders are encoded as never indexed literals, so intermediaries
+// do not add them to a compression context, rfc 7541 s7.1.3.
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+}
+
+// encoder encodes HPACK header blocks. It does not use the dynamic table,
+// so holds no state across header blocks.
+type encoder struct{}
+
+// encode appends the encoding of headers, whose names must be lower case, to dst.
+func (encoder) encode(dst []byte, headers []client.Header) []byte {
+	for _, h := range headers {
+		f := headerField{h.Key, h.Value}
+		if i, ok := staticIndex[f]; ok {
+			dst = appendInt(dst, 0x80, 7, uint64(i))
+			continue
+		}
+		prefix := byte(0x00) // without indexing
+		if sensitiveHeaders[f.name] {
+			prefix = 0x10 // never indexed
+		}
+		if i, ok := staticIndex[headerField{name: f.name}]; ok {
+			dst = appendInt(dst, prefix, 4, uint64(i))
+		} else {
+			dst = appendInt(dst, prefix, 4, 0)
+			dst = appendString(dst, f.name)
+		}
+		dst = appendString(dst, f.value)
+	}
+	return dst
+}
+
+// appendInt appends i encoded as an integer with an n bit prefix, rfc 7541 s5.1.
+// The bits of first not used by the prefix are preserved.
+func appendInt(dst []byte, first byte, n uint, i uint64) []byte {
+	mask := uint64(1)<<n - 1
+	if i < mask {
+		return append(dst, first|byte(i))
+	}
+	dst = append(dst, first|byte(mask))
+	for i -= mask; i >= 0x80; i >>= 7 {
+		dst = append(dst, byte(i&0x7f)|0x80)
+	}
+	return append(dst, byte(i))
+}
+
+// appendString appends s as a string literal, Huffman encoded if that is shorter, rfc 7541 s5.2.
+func appendString(dst []byte, s string) []byte {
+	if l := huffmanEncodedLen(s); l < len(s) {
+		dst = appendInt(dst, 0x80, 7, uint64(l))
+		return appendHuffman(dst, s)
+	}
+	dst = appendInt(dst, 0x00, 7, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// lower returns s in lower case, as required of HTTP/2 field names, rfc 7540 s8.1.2.
+func lower(s string) string { return strings.ToLower(s) }
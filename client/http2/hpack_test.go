@@ -0,0 +1,215 @@
+package http2
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/http/client"
+)
+
+func h(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var appendIntTests = []struct {
+	n        uint
+	i        uint64
+	expected []byte
+}{
+	// rfc 7541 appendix C.1
+	{5, 10, h("0a")},
+	{5, 1337, h("1f9a0a")},
+	{8, 42, h("2a")},
+	{7, 127, h("7f00")},
+}
+
+func TestAppendInt(t *testing.T) {
+	for _, tt := range appendIntTests {
+		actual := appendInt(nil, 0, tt.n, tt.i)
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("appendInt(%d, %d): expected %x, got %x", tt.n, tt.i, tt.expected, actual)
+		}
+		i, rest, err := readInt(actual, tt.n)
+		if i != tt.i || len(rest) != 0 || err != nil {
+			t.Errorf("readInt(%x, %d): expected %d, got %d %x %v", actual, tt.n, tt.i, i, rest, err)
+		}
+	}
+}
+
+var huffmanTests = []struct {
+	s        string
+	expected []byte
+}{
+	// rfc 7541 appendix C.4
+	{"www.example.com", h("f1e3 c2e5 f23a 6ba0 ab90 f4ff")},
+	{"no-cache", h("a8eb 1064 9cbf")},
+	{"custom-key", h("25a8 49e9 5ba9 7d7f")},
+	{"custom-value", h("25a8 49e9 5bb8 e8b4 bf")},
+}
+
+func TestHuffman(t *testing.T) {
+	for _, tt := range huffmanTests {
+		actual := appendHuffman(nil, tt.s)
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("appendHuffman(%q): expected %x, got %x", tt.s, tt.expected, actual)
+		}
+		if l := huffmanEncodedLen(tt.s); l != len(tt.expected) {
+			t.Errorf("huffmanEncodedLen(%q): expected %d, got %d", tt.s, len(tt.expected), l)
+		}
+		decoded, err := huffmanDecode(tt.expected)
+		if string(decoded) != tt.s || err != nil {
+			t.Errorf("huffmanDecode(%x): expected %q, got %q %v", tt.expected, tt.s, decoded, err)
+		}
+	}
+}
+
+func TestHuffmanInvalidPadding(t *testing.T) {
+	// "a" is 00011, padding must be the most significant bits of EOS, all ones.
+	if _, err := huffmanDecode([]byte{0x18}); err == nil {
+		t.Error("huffmanDecode: expected error, got nil")
+	}
+	// padding longer than 7 bits.
+	if _, err := huffmanDecode(h("1fff")); err == nil {
+		t.Error("huffmanDecode: expected error, got nil")
+	}
+}
+
+func headers(kv ...string) []client.Header {
+	var hs []client.Header
+	for i := 0; i < len(kv); i += 2 {
+		hs = append(hs, client.Header{Key: kv[i], Value: kv[i+1]})
+	}
+	return hs
+}
+
+// successive header blocks decoded with the same decoder, rfc 7541 appendix C.3 and C.4.
+var decoderTests = [][]struct {
+	block    []byte
+	expected []client.Header
+	size     int // dynamic table size after decoding
+}{{
+	{
+		h("8286 8441 0f77 7777 2e65 7861 6d70 6c65 2e63 6f6d"),
+		headers(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com"),
+		57,
+	}, {
+		h("8286 84be 5808 6e6f 2d63 6163 6865"),
+		headers(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com", "cache-control", "no-cache"),
+		110,
+	}, {
+		h("8287 85bf 400a 6375 7374 6f6d 2d6b 6579 0c63 7573 746f 6d2d 7661 6c75 65"),
+		headers(":method", "GET", ":scheme", "https", ":path", "/index.html", ":authority", "www.example.com", "custom-key", "custom-value"),
+		164,
+	},
+}, {
+	{
+		h("8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff"),
+		headers(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com"),
+		57,
+	}, {
+		h("8286 84be 5886 a8eb 1064 9cbf"),
+		headers(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com", "cache-control", "no-cache"),
+		110,
+	}, {
+		h("8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf"),
+		headers(":method", "GET", ":scheme", "https", ":path", "/index.html", ":authority", "www.example.com", "custom-key", "custom-value"),
+		164,
+	},
+}}
+
+func TestDecoder(t *testing.T) {
+	for i, blocks := range decoderTests {
+		d := newDecoder(4096)
+		for j, tt := range blocks {
+			actual, err := d.decode(tt.block)
+			if err != nil {
+				t.Fatalf("decoder %d.%d: %v", i, j, err)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("decoder %d.%d: expected %v, got %v", i, j, tt.expected, actual)
+			}
+			if d.size != tt.size {
+				t.Errorf("decoder %d.%d: table size: expected %d, got %d", i, j, tt.size, d.size)
+			}
+		}
+	}
+}
+
+func TestDecoderEviction(t *testing.T) {
+	d := newDecoder(100)
+	// two literals with incremental indexing of 32+1+40 bytes each, only one fits.
+	var block []byte
+	for _, name := range []string{"a", "b"} {
+		block = append(block, 0x40)
+		block = appendInt(block, 0, 7, 1)
+		block = append(block, name...)
+		block = appendInt(block, 0, 7, 40)
+		block = append(block, strings.Repeat("x", 40)...)
+	}
+	if _, err := d.decode(block); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.dynamic) != 1 || d.dynamic[0].name != "b" || d.size != 73 {
+		t.Errorf("decoder: expected only %q in table, got %v", "b", d.dynamic)
+	}
+	// a size update evicts everything.
+	if _, err := d.decode([]byte{0x20}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.dynamic) != 0 || d.size != 0 {
+		t.Errorf("decoder: expected empty table, got %v", d.dynamic)
+	}
+}
+
+var decoderErrorTests = [][]byte{
+	h("80"),                          // index 0
+	h("be"),                          // index 62, dynamic table empty
+	h("41"),                          // truncated string
+	h("4105 6162"),                   // string shorter than its length
+	h("3fe2 1f"),                     // size update above the limit
+	h("82 20"),                       // size update after a header field
+	h("ff ffff ffff ffff ffff ffff"), // integer overflow
+}
+
+func TestDecoderErrors(t *testing.T) {
+	for _, tt := range decoderErrorTests {
+		if _, err := newDecoder(4096).decode(tt); err == nil {
+			t.Errorf("decode(%x): expected error, got nil", tt)
+		}
+	}
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	hs := headers(
+		":method", "GET",
+		":scheme", "https",
+		":path", "/search?q=gorilla",
+		":authority", "www.example.com",
+		"accept-encoding", "gzip, deflate",
+		"authorization", "Bearer secret",
+		"x-custom", strings.Repeat("value ", 50),
+		"x-empty", "",
+	)
+	block := encoder{}.encode(nil, hs)
+	actual, err := newDecoder(4096).decode(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, hs) {
+		t.Errorf("encode/decode: expected %v, got %v", hs, actual)
+	}
+}
+
+func TestEncoderNeverIndexed(t *testing.T) {
+	block := encoder{}.encode(nil, headers("authorization", "secret"))
+	// literal never indexed, name index 23.
+	if block[0] != 0x1f || block[1] != 23-15 {
+		t.Errorf("encode: expected never indexed literal, got %x", block)
+	}
+}
@@ -0,0 +1,737 @@
+// Package http2 implements the client side of HTTP/2, rfc 7540.
+//
+// A Conn speaks HTTP/2 over an io.ReadWriter, in the same way client.Client
+// speaks HTTP/1.x, multiplexing concurrent requests as streams over a single
+// connection. The connection may be negotiated with ALPN, by offering "h2"
+// in tls.Config.NextProtos, or used with prior knowledge over plain TCP, known
+// as h2c, rfc 7540 s3.4.
+package http2
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/http/client"
+)
+
+// NextProto is the ALPN protocol identifier of HTTP/2 over TLS.
+const NextProto = "h2"
+
+const (
+	// clientPreface is sent before any frames, rfc 7540 s3.5.
+	clientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	// streamWindow is the receive window advertised for each stream. A
+	// WINDOW_UPDATE is sent once half of it has been read from the body.
+	streamWindow = 1 << 20
+
+	// connWindow is the receive window of the connection. As data is returned
+	// to the connection window on receipt, it need only be large enough not
+	// to limit the sum of the stream windows in practice.
+	connWindow = 1 << 30
+
+	// initialWindow is the initial window of streams and the connection
+	// before any SETTINGS or WINDOW_UPDATE are exchanged, rfc 7540 s6.9.2.
+	initialWindow = 65535
+
+	// headerTableSize is the size of the HPACK dynamic table used to decode
+	// response headers.
+	headerTableSize = 4096
+
+	// maxHeaderListSize is the largest header list the Conn will accept.
+	maxHeaderListSize = 1 << 20
+
+	// maxStreamID is the largest stream identifier, rfc 7540 s5.1.1.
+	maxStreamID = 1<<31 - 1
+)
+
+var (
+	errClosed            = errors.New("http2: connection closed")
+	errStreamsExhausted  = errors.New("http2: stream identifiers exhausted")
+	errBodyClosed        = errors.New("http2: response body closed")
+	errNoPendingRequests = errors.New("http2: ReadResponse called without a pending request")
+)
+
+// Option configures a Conn returned by NewConn.
+type Option func(*Conn)
+
+// Scheme sets the value of the :scheme pseudo header sent with each request.
+// By default it is "https" if the io.ReadWriter passed to NewConn has a
+// ConnectionState method, as *tls.Conn does, and "http" otherwise.
+func Scheme(scheme string) Option {
+	return func(c *Conn) { c.scheme = scheme }
+}
+
+// Conn is a HTTP/2 connection to a server. RoundTrip may be called
+// concurrently, each request being sent on its own stream. Conn also
+// implements client.Client, answering requests in the order they were written.
+type Conn struct {
+	closer io.Closer
+	fr     *Framer
+	scheme string
+	dec    *decoder // used only by readLoop
+
+	wmu  sync.Mutex // serialises frame writes and the assignment of stream identifiers
+	enc  encoder
+	hbuf []byte
+
+	mu      sync.Mutex // protects the following fields and those of each stream
+	cond    *sync.Cond // broadcast whenever stream or connection state changes
+	streams map[uint32]*stream
+	nextID  uint32
+	active  uint32 // streams open or reserved by a request yet to be assigned an id
+
+	maxStreams   uint32 // SETTINGS_MAX_CONCURRENT_STREAMS of the server
+	maxFrameSize uint32 // SETTINGS_MAX_FRAME_SIZE of the server
+	peerWindow   int64  // SETTINGS_INITIAL_WINDOW_SIZE of the server
+	sendWindow   int64  // the connection send window
+
+	goAway  *GoAwayError
+	err     error     // set once the connection has failed or been closed
+	pending []*stream // streams written by WriteRequest awaiting ReadResponse
+}
+
+// NewConn returns a Conn which speaks HTTP/2 over rw, sending the client
+// connection preface and initial SETTINGS. If rw is an io.Closer it is closed
+// when the Conn is closed or fails.
+func NewConn(rw io.ReadWriter, options ...Option) (*Conn, error) {
+	c := &Conn{
+		fr:           NewFramer(rw, bufio.NewReader(rw)),
+		scheme:       "http",
+		dec:          newDecoder(headerTableSize),
+		streams:      make(map[uint32]*stream),
+		nextID:       1,
+		maxStreams:   maxStreamID, // unlimited until the server says otherwise
+		maxFrameSize: defaultMaxFrameSize,
+		peerWindow:   initialWindow,
+		sendWindow:   initialWindow,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.dec.maxListSize = maxHeaderListSize
+	if closer, ok := rw.(io.Closer); ok {
+		c.closer = closer
+	}
+	if _, ok := rw.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		c.scheme = "https"
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if _, err := io.WriteString(rw, clientPreface); err != nil {
+		return nil, err
+	}
+	err := c.fr.WriteSettings(
+		Setting{SettingEnablePush, 0},
+		Setting{SettingInitialWindowSize, streamWindow},
+		Setting{SettingMaxHeaderListSize, maxHeaderListSize},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.fr.WriteWindowUpdate(0, connWindow-initialWindow); err != nil {
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Available reports whether new requests may be sent on the Conn. It returns
+// false once the connection has failed or been closed, or the server has
+// sent GOAWAY.
+func (c *Conn) Available() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err == nil && c.goAway == nil && c.nextID <= maxStreamID
+}
+
+// Close sends GOAWAY and closes the connection. Outstanding requests fail.
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	err := c.fr.WriteGoAway(0, ErrCodeNo, nil)
+	c.wmu.Unlock()
+	c.fail(errClosed)
+	return err
+}
+
+// RoundTrip sends req on a new stream and returns the response. The request
+// body, if any, is sent in the background and may still be being read when
+// RoundTrip returns. If sending the body fails the stream is reset and the
+// error is returned by RoundTrip, or by reading the response body.
+//
+// Header names are sent in lower case. The Host header, if any, is sent as
+// the :authority pseudo header. Headers specific to HTTP/1.x connections,
+// such as Connection and Transfer-Encoding, are not sent.
+func (c *Conn) RoundTrip(req *client.Request) (*client.Response, error) {
+	s, err := c.writeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.response()
+}
+
+// WriteRequest sends req on a new stream. Its response is returned by a later
+// call to ReadResponse.
+func (c *Conn) WriteRequest(req *client.Request) error {
+	s, err := c.writeRequest(req)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.pending = append(c.pending, s)
+	c.mu.Unlock()
+	return nil
+}
+
+// ReadResponse returns the response to the earliest request written by
+// WriteRequest which has not yet been answered.
+func (c *Conn) ReadResponse() (*client.Response, error) {
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return nil, errNoPendingRequests
+	}
+	s := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+	return s.response()
+}
+
+func (c *Conn) writeRequest(req *client.Request) (*stream, error) {
+	length := req.ContentLength()
+	headers, err := c.requestHeaders(req, length)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.reserve(); err != nil {
+		return nil, err
+	}
+	endStream := req.Body == nil || length == 0 && req.Trailers == nil
+	s, err := c.openStream(headers, endStream, req.Trace)
+	if err != nil {
+		return nil, err
+	}
+	t := req.Trace
+	if t != nil && t.WroteHeaders != nil {
+		t.WroteHeaders()
+	}
+	if endStream {
+		if t != nil && t.WroteRequest != nil {
+			t.WroteRequest(nil)
+		}
+		return s, nil
+	}
+	// the body is sent concurrently with reading the response, which the
+	// server may begin to send, and wait on being read, before the body
+	// is complete.
+	go func() {
+		err := s.writeBody(req.Body, req.Trailers)
+		if t != nil && t.WroteRequest != nil {
+			t.WroteRequest(err)
+		}
+	}()
+	return s, nil
+}
+
+// connectionHeaders are specific to HTTP/1.x connections and are not sent
+// over HTTP/2, rfc 7540 s8.1.2.2.
+var connectionHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// requestHeaders returns the header list of req, including pseudo headers.
+func (c *Conn) requestHeaders(req *client.Request, length int64) ([]client.Header, error) {
+	path := req.Path
+	if q := strings.Join(req.Query, "&"); q != "" {
+		path += "?" + q
+	}
+	// the fields are validated before their names are lowered, as a name
+	// which is not a token may be lowered to one.
+	if err := client.ValidRequest(req); err != nil {
+		return nil, err
+	}
+	var authority string
+	var fields []client.Header
+	for _, h := range req.Headers {
+		key := lower(h.Key)
+		switch {
+		case key == "host":
+			authority = h.Value
+		case connectionHeaders[key], key == "content-length":
+		case key == "te" && !strings.EqualFold(h.Value, "trailers"):
+		default:
+			fields = append(fields, client.Header{Key: key, Value: h.Value})
+		}
+	}
+	headers := []client.Header{
+		{Key: ":method", Value: req.Method},
+		{Key: ":scheme", Value: c.scheme},
+		{Key: ":authority", Value: authority},
+		{Key: ":path", Value: path},
+	}
+	if req.Body != nil && length >= 0 {
+		headers = append(headers, client.Header{Key: "content-length", Value: strconv.FormatInt(length, 10)})
+	}
+	return append(headers, fields...), nil
+}
+
+// reserve waits until the server permits another concurrent stream and
+// reserves it for a request.
+func (c *Conn) reserve() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		switch {
+		case c.err != nil:
+			return c.err
+		case c.goAway != nil:
+			return c.goAway
+		case c.nextID > maxStreamID:
+			return errStreamsExhausted
+		case c.active < c.maxStreams:
+			c.active++
+			return nil
+		}
+		c.cond.Wait()
+	}
+}
+
+// openStream assigns the next stream identifier and sends headers on it. The
+// caller must have reserved the stream.
+func (c *Conn) openStream(headers []client.Header, endStream bool, trace *client.Trace) (*stream, error) {
+	// stream identifiers must be used in order, so hold wmu until the headers are sent.
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	if c.err != nil || c.nextID > maxStreamID {
+		c.active--
+		err := c.err
+		if err == nil {
+			err = errStreamsExhausted
+		}
+		c.mu.Unlock()
+		return nil, err
+	}
+	s := &stream{
+		c:          c,
+		id:         c.nextID,
+		sendWindow: c.peerWindow,
+		recvWindow: streamWindow,
+		trace:      trace,
+	}
+	c.nextID += 2
+	c.streams[s.id] = s
+	maxFrameSize := int(c.maxFrameSize)
+	c.mu.Unlock()
+
+	if err := c.writeHeaders(s.id, headers, endStream, maxFrameSize); err != nil {
+		c.fail(err)
+		return nil, err
+	}
+	return s, nil
+}
+
+// writeHeaders writes a header block as a HEADERS frame, followed by
+// CONTINUATION frames if it is larger than maxFrameSize. The caller must hold wmu.
+func (c *Conn) writeHeaders(id uint32, headers []client.Header, endStream bool, maxFrameSize int) error {
+	c.hbuf = c.enc.encode(c.hbuf[:0], headers)
+	block := c.hbuf
+	t, flags := FrameHeaders, Flags(0)
+	if endStream {
+		flags |= FlagEndStream
+	}
+	for {
+		frag := block
+		if len(frag) > maxFrameSize {
+			frag = frag[:maxFrameSize]
+		}
+		block = block[len(frag):]
+		if len(block) == 0 {
+			flags |= FlagEndHeaders
+		}
+		if err := c.fr.WriteFrame(t, flags, id, frag); err != nil {
+			return err
+		}
+		if len(block) == 0 {
+			return nil
+		}
+		t, flags = FrameContinuation, 0
+	}
+}
+
+// write writes a single frame, failing the connection on error.
+func (c *Conn) write(t FrameType, flags Flags, id uint32, payload []byte) error {
+	c.wmu.Lock()
+	err := c.fr.WriteFrame(t, flags, id, payload)
+	c.wmu.Unlock()
+	if err != nil {
+		c.fail(err)
+	}
+	return err
+}
+
+// fail records err as the reason the connection can no longer be used, fails
+// every outstanding stream and closes the underlying connection.
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.err = err
+	for _, s := range c.streams {
+		if s.recvErr == nil {
+			s.recvErr = err
+		}
+		c.closeStream(s)
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	if c.closer != nil {
+		c.closer.Close()
+	}
+}
+
+// closeStream forgets s, releasing its slot for another request. The caller must hold mu.
+func (c *Conn) closeStream(s *stream) {
+	if c.streams[s.id] != s {
+		return
+	}
+	delete(c.streams, s.id)
+	c.active--
+	c.cond.Broadcast()
+}
+
+// resetStream abandons s, sending RST_STREAM with code. The stream fails with err.
+func (c *Conn) resetStream(s *stream, code ErrCode, err error) {
+	c.mu.Lock()
+	if s.recvErr == nil {
+		s.recvErr = err
+	}
+	c.closeStream(s)
+	c.mu.Unlock()
+	c.wmu.Lock()
+	c.fr.WriteRSTStream(s.id, code)
+	c.wmu.Unlock()
+}
+
+// readLoop reads and processes frames until the connection fails.
+func (c *Conn) readLoop() {
+	err := c.readFrames()
+	if ce, ok := err.(connError); ok {
+		c.wmu.Lock()
+		c.fr.WriteGoAway(0, ce.Code, []byte(ce.Reason))
+		c.wmu.Unlock()
+	}
+	if err == io.EOF {
+		err = errClosed
+	}
+	c.fail(err)
+}
+
+func (c *Conn) readFrames() error {
+	// the server preface is a SETTINGS frame, rfc 7540 s3.5.
+	f, err := c.fr.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if f.Type != FrameSettings || f.Flags.Has(FlagAck) {
+		return connError{ErrCodeProtocol, fmt.Sprintf("expected SETTINGS, got %v", f.Type)}
+	}
+	for {
+		if err := c.processFrame(f); err != nil {
+			return err
+		}
+		if f, err = c.fr.ReadFrame(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Conn) processFrame(f *Frame) error {
+	switch f.Type {
+	case FrameData:
+		return c.processData(f)
+	case FrameHeaders:
+		return c.processHeaders(f)
+	case FrameRSTStream:
+		return c.processRSTStream(f)
+	case FrameSettings:
+		return c.processSettings(f)
+	case FramePing:
+		return c.processPing(f)
+	case FrameGoAway:
+		return c.processGoAway(f)
+	case FrameWindowUpdate:
+		return c.processWindowUpdate(f)
+	case FramePushPromise:
+		return connError{ErrCodeProtocol, "PUSH_PROMISE received with push disabled"}
+	case FrameContinuation:
+		return connError{ErrCodeProtocol, "unexpected CONTINUATION"}
+	default:
+		// PRIORITY and unknown frame types are ignored, rfc 7540 s4.1.
+		return nil
+	}
+}
+
+// stream returns the open stream with the given id, or nil if it has been
+// closed. Frames for streams which have never been opened, or for stream
+// zero, are connection errors. The caller must hold mu.
+func (c *Conn) stream(t FrameType, id uint32) (*stream, error) {
+	if id == 0 || id%2 == 0 || id >= c.nextID {
+		return nil, connError{ErrCodeProtocol, fmt.Sprintf("%v frame on invalid stream %d", t, id)}
+	}
+	return c.streams[id], nil
+}
+
+func (c *Conn) processData(f *Frame) error {
+	data, err := f.Data()
+	if err != nil {
+		return err
+	}
+	// data is returned to the connection window on receipt; the stream
+	// window limits how much each stream may buffer.
+	if f.Length > 0 {
+		if err := c.write(FrameWindowUpdate, 0, 0, binary.BigEndian.AppendUint32(nil, f.Length)); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	s, err := c.stream(f.Type, f.StreamID)
+	if err != nil || s == nil {
+		c.mu.Unlock()
+		return err
+	}
+	if int64(f.Length) > s.recvWindow {
+		c.mu.Unlock()
+		return connError{ErrCodeFlowControl, fmt.Sprintf("stream %d exceeded its flow control window", s.id)}
+	}
+	if s.resp == nil {
+		c.mu.Unlock()
+		c.resetStream(s, ErrCodeProtocol, fmt.Errorf("http2: stream %d: DATA received before HEADERS", s.id))
+		return nil
+	}
+	s.recvWindow -= int64(f.Length)
+	s.unacked += int64(f.Length) - int64(len(data)) // padding is returned with the next WINDOW_UPDATE
+	s.buf.Write(data)
+	if f.Flags.Has(FlagEndStream) {
+		s.recvErr = io.EOF
+		c.closeStream(s)
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Conn) processHeaders(f *Frame) error {
+	frag, err := f.Data()
+	if err != nil {
+		return err
+	}
+	if f.Flags.Has(FlagPriority) {
+		if len(frag) < 5 {
+			return connError{ErrCodeFrameSize, "HEADERS frame too short for priority"}
+		}
+		frag = frag[5:]
+	}
+	// the frame payload is reused by the next ReadFrame, so take a copy.
+	block := append([]byte(nil), frag...)
+	id, flags := f.StreamID, f.Flags
+	for !f.Flags.Has(FlagEndHeaders) {
+		if f, err = c.fr.ReadFrame(); err != nil {
+			return err
+		}
+		if f.Type != FrameContinuation || f.StreamID != id {
+			return connError{ErrCodeProtocol, fmt.Sprintf("expected CONTINUATION for stream %d, got %v", id, f.FrameHeader)}
+		}
+		if len(block)+len(f.Payload) > maxHeaderListSize {
+			return connError{ErrCodeEnhanceYourCalm, "header block too large"}
+		}
+		block = append(block, f.Payload...)
+	}
+	// the block must be decoded, even if the stream is closed, to keep the
+	// decoder's dynamic table in sync with the server.
+	fields, err := c.dec.decode(block)
+	if err != nil {
+		return connError{ErrCodeCompression, err.Error()}
+	}
+	c.mu.Lock()
+	s, err := c.stream(FrameHeaders, id)
+	if err != nil || s == nil {
+		c.mu.Unlock()
+		return err
+	}
+	if t := s.trace; t != nil {
+		// the first header block of the stream begins its response.
+		s.trace = nil
+		if t.GotFirstResponseByte != nil {
+			t.GotFirstResponseByte()
+		}
+	}
+	endStream := flags.Has(FlagEndStream)
+	if s.resp == nil {
+		resp, err := response(s, fields)
+		if err == nil && resp.IsInformational() && endStream {
+			err = errors.New("informational response ends stream")
+		}
+		if err != nil {
+			c.mu.Unlock()
+			c.resetStream(s, ErrCodeProtocol, fmt.Errorf("http2: stream %d: %v", s.id, err))
+			return nil
+		}
+		if resp.IsInformational() {
+			c.mu.Unlock()
+			return nil // interim responses are discarded.
+		}
+		s.resp = resp
+	} else {
+		if !endStream {
+			c.mu.Unlock()
+			c.resetStream(s, ErrCodeProtocol, fmt.Errorf("http2: stream %d: trailers do not end stream", s.id))
+			return nil
+		}
+		s.trailers = canonicalHeaders(fields)
+	}
+	if endStream {
+		s.recvErr = io.EOF
+		c.closeStream(s)
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Conn) processRSTStream(f *Frame) error {
+	if len(f.Payload) != 4 {
+		return connError{ErrCodeFrameSize, "RST_STREAM frame length not 4"}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, err := c.stream(f.Type, f.StreamID)
+	if err != nil || s == nil {
+		return err
+	}
+	if s.recvErr == nil {
+		s.recvErr = &StreamError{StreamID: s.id, Code: ErrCode(binary.BigEndian.Uint32(f.Payload))}
+	}
+	c.closeStream(s)
+	return nil
+}
+
+func (c *Conn) processSettings(f *Frame) error {
+	if f.StreamID != 0 {
+		return connError{ErrCodeProtocol, "SETTINGS frame on a stream"}
+	}
+	if f.Flags.Has(FlagAck) {
+		if f.Length != 0 {
+			return connError{ErrCodeFrameSize, "SETTINGS ACK with payload"}
+		}
+		return nil
+	}
+	settings, err := f.Settings()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for _, s := range settings {
+		switch s.ID {
+		case SettingMaxConcurrentStreams:
+			c.maxStreams = s.Value
+		case SettingInitialWindowSize:
+			if s.Value > maxWindow {
+				c.mu.Unlock()
+				return connError{ErrCodeFlowControl, "SETTINGS_INITIAL_WINDOW_SIZE too large"}
+			}
+			// the change applies to the windows of open streams, rfc 7540 s6.9.2.
+			delta := int64(s.Value) - c.peerWindow
+			for _, st := range c.streams {
+				st.sendWindow += delta
+			}
+			c.peerWindow = int64(s.Value)
+		case SettingMaxFrameSize:
+			if s.Value < defaultMaxFrameSize || s.Value > maxFrameSizeLimit {
+				c.mu.Unlock()
+				return connError{ErrCodeProtocol, "invalid SETTINGS_MAX_FRAME_SIZE"}
+			}
+			c.maxFrameSize = s.Value
+		}
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return c.write(FrameSettings, FlagAck, 0, nil)
+}
+
+func (c *Conn) processPing(f *Frame) error {
+	if f.StreamID != 0 || len(f.Payload) != 8 {
+		return connError{ErrCodeProtocol, "invalid PING frame"}
+	}
+	if f.Flags.Has(FlagAck) {
+		return nil
+	}
+	return c.write(FramePing, FlagAck, 0, f.Payload)
+}
+
+func (c *Conn) processGoAway(f *Frame) error {
+	if f.StreamID != 0 || len(f.Payload) < 8 {
+		return connError{ErrCodeProtocol, "invalid GOAWAY frame"}
+	}
+	g := &GoAwayError{
+		LastStreamID: binary.BigEndian.Uint32(f.Payload) & maxStreamID,
+		Code:         ErrCode(binary.BigEndian.Uint32(f.Payload[4:])),
+		Debug:        string(f.Payload[8:]),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.goAway = g
+	// streams the server did not process may be retried elsewhere.
+	for id, s := range c.streams {
+		if id > g.LastStreamID {
+			s.recvErr = g
+			c.closeStream(s)
+		}
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *Conn) processWindowUpdate(f *Frame) error {
+	if len(f.Payload) != 4 {
+		return connError{ErrCodeFrameSize, "WINDOW_UPDATE frame length not 4"}
+	}
+	incr := int64(binary.BigEndian.Uint32(f.Payload) & maxWindow)
+	c.mu.Lock()
+	if f.StreamID == 0 {
+		if incr == 0 || c.sendWindow+incr > maxWindow {
+			c.mu.Unlock()
+			return connError{ErrCodeFlowControl, "invalid connection WINDOW_UPDATE"}
+		}
+		c.sendWindow += incr
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		return nil
+	}
+	s, err := c.stream(f.Type, f.StreamID)
+	if err != nil || s == nil {
+		c.mu.Unlock()
+		return err
+	}
+	if incr == 0 || s.sendWindow+incr > maxWindow {
+		c.mu.Unlock()
+		c.resetStream(s, ErrCodeFlowControl, fmt.Errorf("http2: stream %d: invalid WINDOW_UPDATE", s.id))
+		return nil
+	}
+	s.sendWindow += incr
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,444 @@
+package http2
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/http/client"
+)
+
+func testMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		fmt.Fprintf(w, "%s %s %s %s %s", r.Method, r.Host, r.URL.RequestURI(), r.Header.Get("X-Test"), r.Header.Get("Connection"))
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Length", fmt.Sprint(r.ContentLength))
+		if len(r.Trailer) == 0 {
+			io.Copy(w, r.Body)
+			return
+		}
+		// trailers are only available once the body has been read.
+		body, _ := io.ReadAll(r.Body)
+		for k, v := range r.Trailer {
+			w.Header().Set("X-Trailer-"+k, v[0])
+		}
+		w.Write(body)
+	})
+	mux.HandleFunc("/trailers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Checksum")
+		io.WriteString(w, "hello")
+		w.Header().Set("Checksum", "1234")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	return mux
+}
+
+// newServer returns a TLS server which negotiates HTTP/2 and a Conn to it.
+func newServer(t *testing.T, handler http.Handler) (*httptest.Server, *Conn) {
+	s := httptest.NewUnstartedServer(handler)
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	tc, err := tls.Dial("tcp", s.Listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{NextProto},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := tc.ConnectionState().NegotiatedProtocol; p != NextProto {
+		t.Fatalf("expected ALPN %q, got %q", NextProto, p)
+	}
+	c, err := NewConn(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+func get(path string, headers ...client.Header) *client.Request {
+	return &client.Request{
+		Method:  "GET",
+		Path:    path,
+		Version: client.HTTP_2_0,
+		Headers: append([]client.Header{{Key: "Host", Value: "example.com"}}, headers...),
+	}
+}
+
+func readBody(t *testing.T, resp *client.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func header(resp *client.Response, key string) string {
+	for _, h := range resp.Headers {
+		if h.Key == key {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+var roundTripTests = []struct {
+	req      *client.Request
+	status   client.Status
+	expected string
+}{
+	{get("/"), client.Status{Code: 200, Reason: "OK"}, "GET example.com /  "},
+	{get("/a/b"), client.Status{Code: 200, Reason: "OK"}, "GET example.com /a/b  "},
+	{
+		&client.Request{Method: "GET", Path: "/q", Query: []string{"a=1", "b=2"}, Headers: []client.Header{{Key: "Host", Value: "example.com"}}},
+		client.Status{Code: 200, Reason: "OK"},
+		"GET example.com /q?a=1&b=2  ",
+	},
+	// header names are sent in lower case, connection specific headers are dropped.
+	{get("/", client.Header{Key: "X-Test", Value: "test"}, client.Header{Key: "Connection", Value: "keep-alive"}), client.Status{Code: 200, Reason: "OK"}, "GET example.com / test "},
+	{get("/status"), client.Status{Code: 418, Reason: ""}, ""},
+}
+
+func TestConnRoundTrip(t *testing.T) {
+	_, c := newServer(t, testMux())
+	for _, tt := range roundTripTests {
+		resp, err := c.RoundTrip(tt.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := readBody(t, resp); resp.Status != tt.status || actual != tt.expected {
+			t.Errorf("RoundTrip(%s): expected %v %q, got %v %q", tt.req.Path, tt.status, tt.expected, resp.Status, actual)
+		}
+		if resp.Version != client.HTTP_2_0 || header(resp, "X-Proto") != "HTTP/2.0" && tt.status.Code == 200 {
+			t.Errorf("RoundTrip(%s): expected HTTP/2.0, got %v %q", tt.req.Path, resp.Version, header(resp, "X-Proto"))
+		}
+	}
+}
+
+var invalidRequestTests = []*client.Request{
+	{Method: "GE T", Path: "/", Headers: []client.Header{{Key: "Host", Value: "example.com"}}},
+	{Method: "GET", Path: "/a b", Headers: []client.Header{{Key: "Host", Value: "example.com"}}},
+	get("/", client.Header{Key: "Bad Name", Value: "x"}),
+	get("/", client.Header{Key: ":path", Value: "/evil"}),
+	// a name which is lowered to a token, "x-key".
+	get("/", client.Header{Key: "X-\u212Aey", Value: "x"}),
+	get("/", client.Header{Key: "X-Test", Value: "a\r\nb"}),
+	get("/", client.Header{Key: "X-Test", Value: "a\x00b"}),
+}
+
+// invalid requests are rejected before they are sent, as they are over HTTP/1.1.
+func TestConnInvalidRequest(t *testing.T) {
+	_, c := newServer(t, testMux())
+	for _, req := range invalidRequestTests {
+		var verr *client.ValidationError
+		if _, err := c.RoundTrip(req); !errors.As(err, &verr) {
+			t.Errorf("RoundTrip(%s %q %v): expected %T, got %v", req.Method, req.Path, req.Headers, verr, err)
+		}
+	}
+	resp, err := c.RoundTrip(get("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := readBody(t, resp); actual != "GET example.com /  " {
+		t.Errorf("RoundTrip: expected %q, got %q", "GET example.com /  ", actual)
+	}
+}
+
+// bodies larger than the initial flow control windows are sent and received.
+func TestConnRoundTripLargeBody(t *testing.T) {
+	_, c := newServer(t, testMux())
+	body := strings.Repeat("all your base are belong to us\n", 100000)
+	for _, tt := range []struct {
+		body   io.Reader
+		length string
+	}{
+		{strings.NewReader(body), fmt.Sprint(len(body))},
+		{io.MultiReader(strings.NewReader(body)), "-1"},
+	} {
+		resp, err := c.RoundTrip(&client.Request{Method: "POST", Path: "/echo", Body: tt.body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := readBody(t, resp); actual != body {
+			t.Errorf("RoundTrip: expected %d bytes, got %d", len(body), len(actual))
+		}
+		if actual := header(resp, "X-Content-Length"); actual != tt.length {
+			t.Errorf("RoundTrip: Content-Length: expected %s, got %s", tt.length, actual)
+		}
+	}
+}
+
+func TestConnTrailers(t *testing.T) {
+	_, c := newServer(t, testMux())
+	resp, err := c.RoundTrip(get("/trailers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Trailers != nil {
+		t.Errorf("Trailers: expected nil before EOF, got %v", resp.Trailers)
+	}
+	readBody(t, resp)
+	if expected := []client.Header{{Key: "Checksum", Value: "1234"}}; !reflect.DeepEqual(resp.Trailers, expected) {
+		t.Errorf("Trailers: expected %v, got %v", expected, resp.Trailers)
+	}
+
+	resp, err = c.RoundTrip(&client.Request{
+		Method:   "POST",
+		Path:     "/echo",
+		Headers:  []client.Header{{Key: "Trailer", Value: "Checksum"}},
+		Body:     strings.NewReader("hello"),
+		Trailers: func() []client.Header { return []client.Header{{Key: "Checksum", Value: "5678"}} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := readBody(t, resp); actual != "hello" || header(resp, "X-Trailer-Checksum") != "5678" {
+		t.Errorf("request trailers: expected %q %q, got %q %q", "hello", "5678", actual, header(resp, "X-Trailer-Checksum"))
+	}
+}
+
+func TestConnConcurrentRoundTrip(t *testing.T) {
+	_, c := newServer(t, testMux())
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := strings.Repeat(fmt.Sprint(i), 10000)
+			resp, err := c.RoundTrip(&client.Request{Method: "PUT", Path: "/echo", Body: strings.NewReader(body)})
+			if err != nil {
+				errs <- err
+				return
+			}
+			actual, err := io.ReadAll(resp.Body)
+			if err == nil && string(actual) != body {
+				err = fmt.Errorf("request %d: unexpected body of %d bytes", i, len(actual))
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// Conn implements client.Client.
+func TestConnClient(t *testing.T) {
+	_, c := newServer(t, testMux())
+	var cc client.Client = c
+	for _, path := range []string{"/1", "/2", "/3"} {
+		if err := cc.WriteRequest(get(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{"/1", "/2", "/3"} {
+		resp, err := cc.ReadResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "GET example.com "+path+"  ", readBody(t, resp); actual != expected {
+			t.Errorf("ReadResponse: expected %q, got %q", expected, actual)
+		}
+	}
+	if _, err := cc.ReadResponse(); err != errNoPendingRequests {
+		t.Errorf("ReadResponse: expected %v, got %v", errNoPendingRequests, err)
+	}
+}
+
+func TestConnBodyClose(t *testing.T) {
+	cancelled := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(cancelled)
+	})
+	_, c := newServer(t, mux)
+	resp, err := c.RoundTrip(get("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.(io.Closer).Close()
+	<-cancelled
+	if _, err := resp.Body.Read(buf); err != errBodyClosed {
+		t.Errorf("Read after Close: expected %v, got %v", errBodyClosed, err)
+	}
+	if !c.Available() {
+		t.Error("Available: expected true after closing a body")
+	}
+}
+
+// tcpPipe returns both ends of a loopback TCP connection. Unlike net.Pipe,
+// writes are buffered so both ends may write at once.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+// scriptedServer performs the server side of the connection preface over conn,
+// then calls fn with a Framer for the connection.
+func scriptedServer(t *testing.T, conn net.Conn, settings []Setting, fn func(*Framer)) {
+	preface := make([]byte, len(clientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != clientPreface {
+		t.Errorf("preface: expected %q, got %q %v", clientPreface, preface, err)
+		return
+	}
+	fr := NewFramer(conn, conn)
+	if err := fr.WriteSettings(settings...); err != nil {
+		t.Error(err)
+		return
+	}
+	fn(fr)
+}
+
+// readFrame reads frames until one of type ft.
+func readFrame(fr *Framer, ft FrameType) (*Frame, error) {
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil || f.Type == ft {
+			return f, err
+		}
+	}
+}
+
+func TestConnStreamErrors(t *testing.T) {
+	c, s := tcpPipe(t)
+	go scriptedServer(t, s, nil, func(fr *Framer) {
+		defer s.Close()
+		f, err := readFrame(fr, FrameHeaders)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		fr.WriteRSTStream(f.StreamID, ErrCodeRefusedStream)
+		if f, err = readFrame(fr, FrameHeaders); err != nil {
+			t.Error(err)
+			return
+		}
+		fr.WriteGoAway(f.StreamID-2, ErrCodeNo, []byte("bye"))
+		readFrame(fr, FrameGoAway)
+	})
+	conn, err := NewConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.RoundTrip(get("/"))
+	if expected := (&StreamError{StreamID: 1, Code: ErrCodeRefusedStream}); !reflect.DeepEqual(err, expected) {
+		t.Errorf("RoundTrip: expected %v, got %v", expected, err)
+	}
+	_, err = conn.RoundTrip(get("/"))
+	var goAway *GoAwayError
+	if !errors.As(err, &goAway) || goAway.LastStreamID != 1 || goAway.Debug != "bye" {
+		t.Errorf("RoundTrip: expected GOAWAY, got %v", err)
+	}
+	if conn.Available() {
+		t.Error("Available: expected false after GOAWAY")
+	}
+	if _, err := conn.RoundTrip(get("/")); !errors.As(err, &goAway) {
+		t.Errorf("RoundTrip: expected GOAWAY, got %v", err)
+	}
+}
+
+// requests wait for a stream when SETTINGS_MAX_CONCURRENT_STREAMS are open.
+func TestConnMaxConcurrentStreams(t *testing.T) {
+	c, s := tcpPipe(t)
+	var buf bytes.Buffer
+	enc := encoder{}
+	go scriptedServer(t, s, []Setting{{SettingMaxConcurrentStreams, 1}}, func(fr *Framer) {
+		defer s.Close()
+		for i := 0; i < 3; i++ {
+			f, err := readFrame(fr, FrameHeaders)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// the next request must not be sent until this stream ends.
+			s.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			if f, err := readFrame(fr, FrameHeaders); err == nil {
+				t.Errorf("stream %d opened while stream 1 open", f.StreamID)
+			}
+			s.SetReadDeadline(time.Time{})
+			block := enc.encode(nil, headers(":status", "200"))
+			fr.WriteFrame(FrameHeaders, FlagEndHeaders, f.StreamID, block)
+			fr.WriteFrame(FrameData, FlagEndStream, f.StreamID, []byte(fmt.Sprint(f.StreamID)))
+		}
+		readFrame(fr, FrameGoAway)
+	})
+	conn, err := NewConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// wait for the SETTINGS to be processed, before which any number of
+	// streams may be opened.
+	for {
+		conn.mu.Lock()
+		max := conn.maxStreams
+		conn.mu.Unlock()
+		if max == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := conn.RoundTrip(get("/"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ := io.ReadAll(resp.Body)
+			mu.Lock()
+			buf.Write(b)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if buf.Len() != 3 {
+		t.Errorf("expected 3 responses, got %q", buf.String())
+	}
+}
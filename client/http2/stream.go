@@ -0,0 +1,292 @@
+package http2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/http/client"
+)
+
+// stream is a single request and response exchanged over a Conn. Its fields
+// are protected by the Conn's mu.
+type stream struct {
+	c  *Conn
+	id uint32
+
+	sendWindow int64 // bytes of request body the server will accept
+	recvWindow int64 // bytes of response body the server may send
+	unacked    int64 // bytes consumed but not yet returned to recvWindow
+
+	trace    *client.Trace    // cleared once the first response headers arrive
+	resp     *client.Response // set once the final response headers arrive
+	buf      bytes.Buffer     // response body received but not yet read
+	trailers []client.Header
+
+	// recvErr is io.EOF once the server has ended the stream, or the reason
+	// the stream failed.
+	recvErr error
+}
+
+// response waits for the final response headers of the stream.
+func (s *stream) response() (*client.Response, error) {
+	c := s.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for s.resp == nil && s.recvErr == nil {
+		c.cond.Wait()
+	}
+	if s.resp == nil {
+		return nil, s.recvErr
+	}
+	return s.resp, nil
+}
+
+// writeBody sends the request body, followed by any trailers, as DATA frames
+// limited by the flow control windows of the stream and connection. If the
+// server ends or resets the stream first, the rest of the body is not sent.
+// Errors are also recorded against the stream or connection.
+func (s *stream) writeBody(body io.Reader, trailers func() []client.Header) error {
+	c := s.c
+	buf := make([]byte, defaultMaxFrameSize)
+	for {
+		n, err := body.Read(buf)
+		for p := buf[:n]; len(p) > 0; {
+			m, done := s.awaitWindow(len(p))
+			if done {
+				return s.abandon()
+			}
+			if err := c.write(FrameData, 0, s.id, p[:m]); err != nil {
+				return err
+			}
+			p = p[m:]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.resetStream(s, ErrCodeCancel, err)
+			return err
+		}
+	}
+	var t []client.Header
+	if trailers != nil {
+		t = trailers()
+	}
+	if len(t) == 0 {
+		return c.write(FrameData, FlagEndStream, s.id, nil)
+	}
+	fields := make([]client.Header, 0, len(t))
+	for _, h := range t {
+		if err := client.ValidHeader(h.Key, h.Value); err != nil {
+			c.resetStream(s, ErrCodeCancel, err)
+			return err
+		}
+		key := lower(h.Key)
+		fields = append(fields, client.Header{Key: key, Value: h.Value})
+	}
+	c.mu.Lock()
+	maxFrameSize := int(c.maxFrameSize)
+	c.mu.Unlock()
+	c.wmu.Lock()
+	err := c.writeHeaders(s.id, fields, true, maxFrameSize)
+	c.wmu.Unlock()
+	if err != nil {
+		c.fail(err)
+	}
+	return err
+}
+
+// awaitWindow waits until up to n bytes may be sent on the stream, deducting
+// them from the send windows. done is true if the stream has ended.
+func (s *stream) awaitWindow(n int) (m int, done bool) {
+	c := s.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for s.recvErr == nil && (s.sendWindow <= 0 || c.sendWindow <= 0) {
+		c.cond.Wait()
+	}
+	if s.recvErr != nil {
+		return 0, true
+	}
+	w := min64(int64(n), s.sendWindow, c.sendWindow, int64(c.maxFrameSize))
+	s.sendWindow -= w
+	c.sendWindow -= w
+	return int(w), false
+}
+
+// abandon stops sending a request body because the stream has ended. If the
+// server has sent its complete response the stream is cancelled, otherwise
+// the reason the stream failed will be returned by response.
+func (s *stream) abandon() error {
+	c := s.c
+	c.mu.Lock()
+	complete := s.recvErr == io.EOF
+	c.mu.Unlock()
+	if complete {
+		c.wmu.Lock()
+		c.fr.WriteRSTStream(s.id, ErrCodeCancel)
+		c.wmu.Unlock()
+	}
+	return nil
+}
+
+func min64(v int64, vs ...int64) int64 {
+	for _, w := range vs {
+		if w < v {
+			v = w
+		}
+	}
+	return v
+}
+
+// body is the Body of a Response read from a stream.
+type body struct {
+	s *stream
+}
+
+// Read reads the response body, returning data to the server's flow control
+// window as it is consumed.
+func (b *body) Read(p []byte) (int, error) {
+	s := b.s
+	c := s.c
+	c.mu.Lock()
+	for s.buf.Len() == 0 && s.recvErr == nil {
+		c.cond.Wait()
+	}
+	if s.buf.Len() == 0 {
+		err := s.recvErr
+		if err == io.EOF {
+			s.resp.Trailers = s.trailers
+		}
+		c.mu.Unlock()
+		return 0, err
+	}
+	n, _ := s.buf.Read(p)
+	s.unacked += int64(n)
+	var incr int64
+	if s.recvErr == nil && s.unacked >= streamWindow/2 {
+		incr, s.unacked = s.unacked, 0
+		s.recvWindow += incr
+	}
+	c.mu.Unlock()
+	if incr > 0 {
+		c.write(FrameWindowUpdate, 0, s.id, binary.BigEndian.AppendUint32(nil, uint32(incr)))
+	}
+	return n, nil
+}
+
+// Close discards the rest of the body. If the server has not finished sending
+// it, the stream is cancelled.
+func (b *body) Close() error {
+	s := b.s
+	c := s.c
+	c.mu.Lock()
+	open := s.recvErr == nil
+	s.buf.Reset()
+	c.mu.Unlock()
+	if open {
+		c.resetStream(s, ErrCodeCancel, errBodyClosed)
+	}
+	return nil
+}
+
+// response builds a Response from the response header fields of s, rfc 7540 s8.1.2.4.
+func response(s *stream, fields []client.Header) (*client.Response, error) {
+	var status string
+	var regular []client.Header
+	for i, h := range fields {
+		if !strings.HasPrefix(h.Key, ":") {
+			regular = fields[i:]
+			break
+		}
+		if h.Key != ":status" || status != "" {
+			return nil, fmt.Errorf("invalid pseudo header %q", h.Key)
+		}
+		status = h.Value
+	}
+	for _, h := range regular {
+		if strings.HasPrefix(h.Key, ":") {
+			return nil, errPseudoHeader
+		}
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || len(status) != 3 {
+		return nil, fmt.Errorf("invalid :status %q", status)
+	}
+	return &client.Response{
+		Version: client.HTTP_2_0,
+		Status:  client.Status{Code: code, Reason: reasons[code]},
+		Headers: canonicalHeaders(regular),
+		Body:    &body{s},
+	}, nil
+}
+
+var errPseudoHeader = errors.New("pseudo header after regular header")
+
+// canonicalHeaders returns fields with their names in canonical form, as
+// HTTP/1.x servers conventionally send them, so the headers of a Response
+// do not depend on the protocol version.
+func canonicalHeaders(fields []client.Header) []client.Header {
+	headers := make([]client.Header, 0, len(fields))
+	for _, h := range fields {
+		headers = append(headers, client.Header{Key: textproto.CanonicalMIMEHeaderKey(h.Key), Value: h.Value})
+	}
+	return headers
+}
+
+// reasons holds the reason phrases of common status codes. HTTP/2 does not
+// carry a reason phrase, rfc 7540 s8.1.2.4.
+var reasons = map[int]string{
+	client.INFO_CONTINUE:                                "Continue",
+	client.SUCCESS_OK:                                   "OK",
+	client.SUCCESS_CREATED:                              "Created",
+	client.SUCCESS_ACCEPTED:                             "Accepted",
+	client.SUCCESS_NON_AUTHORITATIVE:                    "Non-Authoritative Information",
+	client.SUCCESS_NO_CONTENT:                           "No Content",
+	client.SUCCESS_RESET_CONTENT:                        "Reset Content",
+	client.SUCCESS_PARTIAL_CONTENT:                      "Partial Content",
+	client.SUCCESS_MULTI_STATUS:                         "Multi-Status",
+	client.REDIRECTION_MULTIPLE_CHOICES:                 "Multiple Choices",
+	client.REDIRECTION_MOVED_PERMANENTLY:                "Moved Permanently",
+	client.REDIRECTION_MOVED_TEMPORARILY:                "Found",
+	client.REDIRECTION_SEE_OTHER:                        "See Other",
+	client.REDIRECTION_NOT_MODIFIED:                     "Not Modified",
+	client.REDIRECTION_USE_PROXY:                        "Use Proxy",
+	client.REDIRECTION_TEMPORARY_REDIRECT:               "Temporary Redirect",
+	308:                                                 "Permanent Redirect",
+	client.CLIENT_ERROR_BAD_REQUEST:                     "Bad Request",
+	client.CLIENT_ERROR_UNAUTHORIZED:                    "Unauthorized",
+	client.CLIENT_ERROR_PAYMENT_REQUIRED:                "Payment Required",
+	client.CLIENT_ERROR_FORBIDDEN:                       "Forbidden",
+	client.CLIENT_ERROR_NOT_FOUND:                       "Not Found",
+	client.CLIENT_ERROR_METHOD_NOT_ALLOWED:              "Method Not Allowed",
+	client.CLIENT_ERROR_NOT_ACCEPTABLE:                  "Not Acceptable",
+	client.CLIENT_ERROR_PROXY_AUTHENTIFICATION_REQUIRED: "Proxy Authentication Required",
+	client.CLIENT_ERROR_REQUEST_TIMEOUT:                 "Request Timeout",
+	client.CLIENT_ERROR_CONFLICT:                        "Conflict",
+	client.CLIENT_ERROR_GONE:                            "Gone",
+	client.CLIENT_ERROR_LENGTH_REQUIRED:                 "Length Required",
+	client.CLIENT_ERROR_PRECONDITION_FAILED:             "Precondition Failed",
+	client.CLIENT_ERROR_REQUEST_ENTITY_TOO_LARGE:        "Request Entity Too Large",
+	client.CLIENT_ERROR_REQUEST_URI_TOO_LONG:            "Request URI Too Long",
+	client.CLIENT_ERROR_UNSUPPORTED_MEDIA_TYPE:          "Unsupported Media Type",
+	client.CLIENT_ERROR_REQUESTED_RANGE_NOT_SATISFIABLE: "Requested Range Not Satisfiable",
+	client.CLIENT_ERROR_EXPECTATION_FAILED:              "Expectation Failed",
+	client.CLIENT_ERROR_UNPROCESSABLE_ENTITY:            "Unprocessable Entity",
+	client.CLIENT_ERROR_LOCKED:                          "Locked",
+	client.CLIENT_ERROR_FAILED_DEPENDENCY:               "Failed Dependency",
+	429:                                                 "Too Many Requests",
+	client.SERVER_ERROR_INTERNAL:                        "Internal Server Error",
+	client.SERVER_ERROR_NOT_IMPLEMENTED:                 "Not Implemented",
+	client.SERVER_ERROR_BAD_GATEWAY:                     "Bad Gateway",
+	client.SERVER_ERROR_SERVICE_UNAVAILABLE:             "Service Unavailable",
+	client.SERVER_ERROR_GATEWAY_TIMEOUT:                 "Gateway Timeout",
+	client.SERVER_ERROR_HTTP_VERSION_NOT_SUPPORTED:      "HTTP Version Not Supported",
+	client.SERVER_ERROR_INSUFFICIENT_STORAGE:            "Insufficient Storage",
+}
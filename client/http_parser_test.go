@@ -170,7 +170,8 @@ var requestTests = []struct {
 			"Transfer-Encoding: chunked\r\n" +
 			"\r\n" +
 			"1e\r\nall your base are belong to us\r\n" +
-			"0\r\n",
+			"0\r\n" +
+			"\r\n",
 	},
 }
 
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PipelineError is returned by Pipeline when one or more requests were not
+// answered, usually because the server closed the connection mid pipeline.
+type PipelineError struct {
+	// Answered is the number of requests for which a response was read.
+	Answered int
+
+	// Unanswered holds the requests, in order, for which no response was read.
+	// The server may or may not have processed them.
+	Unanswered []*Request
+
+	// Err is the error which ended the pipeline.
+	Err error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("pipeline: %d of %d requests unanswered: %v", len(e.Unanswered), e.Answered+len(e.Unanswered), e.Err)
+}
+
+func (e *PipelineError) Unwrap() error { return e.Err }
+
+// Retryable returns the unanswered requests which are safe to retry on a new
+// connection. As the server may have processed an unanswered request, only
+// idempotent requests, rfc 9110 s9.2.2, are safe to retry. The caller is
+// responsible for supplying a fresh Body for any request it retries.
+func (e *PipelineError) Retryable() []*Request {
+	var r []*Request
+	for _, req := range e.Unanswered {
+		if req.Idempotent() {
+			r = append(r, req)
+		}
+	}
+	return r
+}
+
+// Idempotent reports whether the request method is idempotent, rfc 9110 s9.2.2.
+func (r *Request) Idempotent() bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	default:
+		return false
+	}
+}
+
+// errConnectionClose is reported when a response asks for the connection to
+// be closed while requests remain unanswered.
+var errConnectionClose = errors.New("server requested connection close")
+
+// Pipeline writes reqs to c back to back, without waiting for each response,
+// then returns their responses in order, rfc 9112 s9.3.2.
+//
+// As each response must be read in full before the next can be read, response
+// bodies are buffered in memory; the Body of each Response returned is a
+// *bytes.Reader.
+//
+// Requests are written concurrently with reading responses, so c must support
+// concurrent calls to WriteRequest and ReadResponse, as the Client returned by
+// NewClient does. Requests carrying an Expect: 100-continue header cannot be
+// pipelined.
+//
+// If the server closes the connection, or asks for it to be closed, before
+// every request is answered, the responses read so far are returned along with
+// a *PipelineError describing the requests left unanswered. The connection
+// must then be closed, which also stops any requests still being written.
+func Pipeline(c Client, reqs []*Request) ([]*Response, error) {
+	for _, req := range reqs {
+		if req.ExpectContinue() {
+			return nil, errors.New("pipeline: cannot pipeline a request with Expect: 100-continue")
+		}
+	}
+	// written receives the result of writing each request, in order, stopping
+	// after the first error.
+	written := make(chan error, len(reqs))
+	go func() {
+		for _, req := range reqs {
+			err := c.WriteRequest(req)
+			written <- err
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var resps []*Response
+	for len(resps) < len(reqs) {
+		// a request which could not be written will never be answered.
+		if err := <-written; err != nil {
+			return resps, &PipelineError{Answered: len(resps), Unanswered: reqs[len(resps):], Err: err}
+		}
+		resp, err := readPipelined(c, reqs[len(resps)])
+		if err != nil {
+			return resps, &PipelineError{Answered: len(resps), Unanswered: reqs[len(resps):], Err: err}
+		}
+		resps = append(resps, resp)
+		if resp.CloseRequested() && len(resps) < len(reqs) {
+			return resps, &PipelineError{Answered: len(resps), Unanswered: reqs[len(resps):], Err: errConnectionClose}
+		}
+	}
+	return resps, nil
+}
+
+// readPipelined reads the response to req, buffering its body.
+func readPipelined(c Client, req *Request) (*Response, error) {
+	for {
+		resp, err := c.ReadResponse()
+		if err != nil {
+			return nil, err
+		}
+		if resp.IsInformational() {
+			continue // interim responses have no body.
+		}
+		var body bytes.Buffer
+		if hasBody(req, resp) {
+			if _, err := io.Copy(&body, resp.Body); err != nil {
+				return nil, err
+			}
+		}
+		resp.Body = bytes.NewReader(body.Bytes())
+		return resp, nil
+	}
+}
+
+// hasBody reports whether resp, the response to req, carries a body, rfc 9112 s6.3.
+func hasBody(req *Request, resp *Response) bool {
+	switch {
+	case strings.EqualFold(req.Method, "HEAD"):
+		return false
+	case resp.Code == SUCCESS_NO_CONTENT, resp.Code == REDIRECTION_NOT_MODIFIED:
+		return false
+	default:
+		return true
+	}
+}
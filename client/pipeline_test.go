@@ -0,0 +1,165 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pipelineServer answers up to n requests read from conn, in order, before closing it.
+// If close is true the last response carries a Connection: close header.
+func pipelineServer(conn net.Conn, n int, close bool) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for i := 0; i < n; i++ {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		msg := fmt.Sprintf("%s %s %s", req.Method, req.URL.Path, body)
+		var connection string
+		if close && i == n-1 {
+			connection = "Connection: close\r\n"
+		}
+		switch {
+		case req.Method == "HEAD":
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\n%sContent-Length: %d\r\n\r\n", connection, len(msg))
+		case i%2 == 0:
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\n%sContent-Length: %d\r\n\r\n%s", connection, len(msg), msg)
+		default:
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\n%sTransfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n0\r\n\r\n", connection, len(msg), msg)
+		}
+	}
+}
+
+func pipelineRequests(methods ...string) []*Request {
+	var reqs []*Request
+	for i, m := range methods {
+		req := &Request{Method: m, Path: fmt.Sprintf("/%d", i), Version: HTTP_1_1}
+		if m == "POST" || m == "PUT" {
+			req.Body = strings.NewReader("body")
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+var pipelineTests = []struct {
+	reqs     []*Request
+	answer   int  // number of requests the server answers
+	close    bool // the last answer requests connection close
+	expected []string
+	// unanswered and retryable are the indexes of the unanswered and retryable requests
+	unanswered, retryable []int
+}{
+	{
+		reqs:     pipelineRequests("GET", "GET", "GET"),
+		answer:   3,
+		expected: []string{"GET /0 ", "GET /1 ", "GET /2 "},
+	},
+	{
+		reqs:     pipelineRequests("GET", "HEAD", "PUT", "GET"),
+		answer:   4,
+		expected: []string{"GET /0 ", "", "PUT /2 body", "GET /3 "},
+	},
+	{
+		reqs:       pipelineRequests("GET", "GET", "POST", "GET"),
+		answer:     1,
+		expected:   []string{"GET /0 "},
+		unanswered: []int{1, 2, 3},
+		retryable:  []int{1, 3},
+	},
+	{
+		reqs:       pipelineRequests("GET", "DELETE", "POST", "PATCH"),
+		answer:     2,
+		close:      true,
+		expected:   []string{"GET /0 ", "DELETE /1 "},
+		unanswered: []int{2, 3},
+	},
+}
+
+func TestPipeline(t *testing.T) {
+	for i, tt := range pipelineTests {
+		c, s := net.Pipe()
+		go pipelineServer(s, tt.answer, tt.close)
+		resps, err := Pipeline(NewClient(c), tt.reqs)
+		c.Close()
+		var actual []string
+		for _, resp := range resps {
+			body, _ := io.ReadAll(resp.Body)
+			actual = append(actual, string(body))
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("Pipeline %d: expected %q, got %q", i, tt.expected, actual)
+		}
+		if tt.unanswered == nil {
+			if err != nil {
+				t.Errorf("Pipeline %d: %v", i, err)
+			}
+			continue
+		}
+		var perr *PipelineError
+		if !errors.As(err, &perr) {
+			t.Errorf("Pipeline %d: expected %T, got %v", i, perr, err)
+			continue
+		}
+		if perr.Answered != len(tt.expected) {
+			t.Errorf("Pipeline %d: Answered: expected %d, got %d", i, len(tt.expected), perr.Answered)
+		}
+		if expected := requestsAt(tt.reqs, tt.unanswered); !reflect.DeepEqual(perr.Unanswered, expected) {
+			t.Errorf("Pipeline %d: Unanswered: expected %v, got %v", i, expected, perr.Unanswered)
+		}
+		if expected := requestsAt(tt.reqs, tt.retryable); !reflect.DeepEqual(perr.Retryable(), expected) {
+			t.Errorf("Pipeline %d: Retryable: expected %v, got %v", i, expected, perr.Retryable())
+		}
+	}
+}
+
+func requestsAt(reqs []*Request, idx []int) []*Request {
+	var r []*Request
+	for _, i := range idx {
+		r = append(r, reqs[i])
+	}
+	return r
+}
+
+func TestPipelineExpectContinue(t *testing.T) {
+	reqs := pipelineRequests("PUT")
+	reqs[0].Headers = []Header{{"Expect", "100-continue"}}
+	c, _ := net.Pipe()
+	defer c.Close()
+	if _, err := Pipeline(NewClient(c), reqs); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+var idempotentTests = []struct {
+	method   string
+	expected bool
+}{
+	{"GET", true},
+	{"HEAD", true},
+	{"PUT", true},
+	{"DELETE", true},
+	{"OPTIONS", true},
+	{"TRACE", true},
+	{"POST", false},
+	{"PATCH", false},
+	{"CONNECT", false},
+}
+
+func TestRequestIdempotent(t *testing.T) {
+	for _, tt := range idempotentTests {
+		req := Request{Method: tt.method}
+		if actual := req.Idempotent(); actual != tt.expected {
+			t.Errorf("Request{Method: %q}.Idempotent(): expected %v, got %v", tt.method, tt.expected, actual)
+		}
+	}
+}
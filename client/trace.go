@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// Trace holds hooks called at each phase of making a request, to measure the
+// time spent in each. Any of the hooks may be nil. Hooks may be called from
+// goroutines other than the one making the request, and while locks are held,
+// so must return promptly and not make requests of their own.
+type Trace struct {
+	// GetConn is called before a connection to hostPort is taken from the
+	// pool or dialed.
+	GetConn func(hostPort string)
+
+	// GotConn is called once a connection has been obtained.
+	GotConn func(ConnInfo)
+
+	// DNSStart and DNSDone are called as the host is looked up.
+	DNSStart func(host string)
+	DNSDone  func(addrs []net.IPAddr, err error)
+
+	// ConnectStart and ConnectDone are called as each address is dialed.
+	// Addresses of both IPv4 and IPv6 may be dialed at once, so these may be
+	// called concurrently.
+	ConnectStart func(network, addr string)
+	ConnectDone  func(network, addr string, err error)
+
+	// TLSHandshakeStart and TLSHandshakeDone are called as https connections
+	// are established.
+	TLSHandshakeStart func()
+	TLSHandshakeDone  func(tls.ConnectionState, error)
+
+	// WroteHeaders is called once the request line and headers are written.
+	WroteHeaders func()
+
+	// Got100Continue is called if the server responds 100 Continue to a
+	// request carrying an Expect: 100-continue header.
+	Got100Continue func()
+
+	// WroteRequest is called once the request, including any body, has been
+	// written, with the error which stopped it, if any.
+	WroteRequest func(err error)
+
+	// GotFirstResponseByte is called when the first byte of the response
+	// arrives.
+	GotFirstResponseByte func()
+
+	// BodyDone is called once the response body has been read to EOF, with n
+	// the number of bytes read and a nil error, or with the error which
+	// ended it, including if the body was closed first.
+	BodyDone func(n int64, err error)
+}
+
+// ConnInfo describes a connection obtained for a request.
+type ConnInfo struct {
+	Conn net.Conn
+
+	// Reused is set if the connection was taken from the pool, or is a
+	// HTTP/2 connection shared with other requests.
+	Reused bool
+}
+
+type traceKey struct{}
+
+// WithTrace returns a copy of ctx carrying t, which is called as requests
+// made with the context progress.
+func WithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// ContextTrace returns the Trace carried by ctx, or nil.
+func ContextTrace(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithTrace(t *testing.T) {
+	if ContextTrace(context.Background()) != nil {
+		t.Error("ContextTrace: expected nil")
+	}
+	trace := new(Trace)
+	if actual := ContextTrace(WithTrace(context.Background(), trace)); actual != trace {
+		t.Errorf("ContextTrace: expected %p, got %p", trace, actual)
+	}
+}
+
+// each pipelined request is traced, with the first byte of its own response.
+func TestPipelineTrace(t *testing.T) {
+	reqs := pipelineRequests("GET", "PUT", "GET")
+	counts := make([][3]int32, len(reqs))
+	for i, req := range reqs {
+		n := &counts[i]
+		req.Trace = &Trace{
+			WroteHeaders:         func() { atomic.AddInt32(&n[0], 1) },
+			WroteRequest:         func(error) { atomic.AddInt32(&n[1], 1) },
+			GotFirstResponseByte: func() { atomic.AddInt32(&n[2], 1) },
+		}
+	}
+	c, s := net.Pipe()
+	defer c.Close()
+	go pipelineServer(s, len(reqs), false)
+	if _, err := Pipeline(NewClient(c), reqs); err != nil {
+		t.Fatal(err)
+	}
+	for i := range counts {
+		for j, event := range []string{"WroteHeaders", "WroteRequest", "GotFirstResponseByte"} {
+			if n := atomic.LoadInt32(&counts[i][j]); n != 1 {
+				t.Errorf("request %d: expected %s to be called once, got %d", i, event, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transcript configures a transcript of the bytes written and read by a
+// Client, in the manner of curl --trace-ascii. Each write or read is recorded
+// with its time, its direction, => for sent and <= for received, and whether
+// it is part of the header or the body of a message. Bytes received are
+// recorded as they are parsed, so a response read ahead, with the body of the
+// one before it, is shown as a message of its own.
+type Transcript struct {
+	// W receives the transcript.
+	W io.Writer
+
+	// MaxBody, if positive, is the most bytes of each message body shown.
+	// Writes and reads beyond it are recorded, but not their contents.
+	MaxBody int
+
+	// RedactHeaders names the headers, matched case insensitively, whose
+	// values are shown as REDACTED.
+	RedactHeaders []string
+}
+
+// Transcribe writes a transcript of the bytes written and read by the Client
+// to t.W.
+func Transcribe(t *Transcript) Option {
+	return func(c *client) { c.transcript.set(t) }
+}
+
+// SetTranscript starts, or if t is nil stops, the transcript of the Client.
+// Clients which are reused for requests with and without a transcript, such
+// as those pooled by a higher layer, may set it before each request.
+func (c *client) SetTranscript(t *Transcript) { c.transcript.set(t) }
+
+// transcriber records a Transcript of the messages sent and received.
+type transcriber struct {
+	mu         sync.Mutex // protects following fields
+	t          *Transcript
+	send, recv message
+	now        func() time.Time
+
+	// pending holds the bytes received but not yet recorded, the last
+	// buffered() of which have not been consumed by the parser.
+	pending  []byte
+	buffered func() int
+	switched bool // the conn speaks another protocol, so reads are recorded as they arrive
+}
+
+// message is the state of the current message in one direction.
+type message struct {
+	dir     string
+	header  bool   // the header is being transcribed
+	line    []byte // a partial header line
+	body    int    // bytes of the body shown
+	omitted bool
+}
+
+func (tr *transcriber) set(t *Transcript) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.t = t
+	if t == nil {
+		tr.pending = nil
+	}
+	tr.send = message{dir: "=> Send", header: true}
+	tr.recv = message{dir: "<= Recv", header: true}
+}
+
+// begin starts a new message in the direction of m.
+func (tr *transcriber) begin(m *message) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if m == &tr.recv {
+		// the rest of the previous message.
+		tr.flush()
+	}
+	*m = message{dir: m.dir, header: true}
+}
+
+// active reports whether a transcript is being recorded.
+func (tr *transcriber) active() bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.t != nil
+}
+
+// received holds p, read into the read buffer, until it is consumed.
+func (tr *transcriber) received(p []byte) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.switched {
+		tr.record(&tr.recv, p)
+		return
+	}
+	tr.flush()
+	if tr.t != nil {
+		tr.pending = append(tr.pending, p...)
+	}
+}
+
+// consumed records the bytes received which have since been consumed.
+func (tr *transcriber) consumed() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.flush()
+}
+
+// switchProtocols records the bytes received so far, and those which follow
+// as they are read, as the conn no longer speaks HTTP.
+func (tr *transcriber) switchProtocols() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.flush()
+	tr.record(&tr.recv, tr.pending)
+	tr.pending = nil
+	tr.switched = true
+}
+
+// flush records the pending bytes which have been consumed. tr.mu must be held.
+func (tr *transcriber) flush() {
+	if len(tr.pending) == 0 {
+		return
+	}
+	n := len(tr.pending) - tr.buffered()
+	if n <= 0 {
+		return
+	}
+	tr.record(&tr.recv, tr.pending[:n])
+	tr.pending = append(tr.pending[:0], tr.pending[n:]...)
+}
+
+// record transcribes p, written or read in the direction of m. tr.mu must be
+// held.
+func (tr *transcriber) record(m *message, p []byte) {
+	if tr.t == nil || len(p) == 0 {
+		return
+	}
+	now := time.Now
+	if tr.now != nil {
+		now = tr.now
+	}
+	ts := now().Format("15:04:05.000000")
+	var b bytes.Buffer
+	if m.header {
+		var h bytes.Buffer
+		n := tr.header(&h, m, p)
+		fmt.Fprintf(&b, "%s %s header, %d bytes\n", ts, m.dir, n)
+		b.Write(h.Bytes())
+		p = p[n:]
+	}
+	if len(p) > 0 {
+		fmt.Fprintf(&b, "%s %s data, %d bytes", ts, m.dir, len(p))
+		shown := p
+		if max := tr.t.MaxBody; max > 0 && m.body+len(p) > max {
+			shown = p[:max-m.body]
+			if !m.omitted {
+				m.omitted = true
+				fmt.Fprintf(&b, ", truncated at %d bytes", max)
+			}
+		}
+		b.WriteByte('\n')
+		m.body += len(shown)
+		writeASCII(&b, shown)
+	}
+	tr.t.W.Write(b.Bytes())
+}
+
+// header transcribes the header lines of p to b, returning the number of
+// bytes of p which were part of the header.
+func (tr *transcriber) header(b *bytes.Buffer, m *message, p []byte) int {
+	n := 0
+	for m.header && n < len(p) {
+		i := bytes.IndexByte(p[n:], '\n')
+		if i < 0 {
+			m.line = append(m.line, p[n:]...)
+			return len(p)
+		}
+		m.line = append(m.line, p[n:n+i+1]...)
+		n += i + 1
+		line := strings.TrimRight(string(m.line), "\r\n")
+		m.line = m.line[:0]
+		if line == "" {
+			m.header = false // the blank line ending the header.
+		}
+		b.WriteString(tr.redact(line))
+		b.WriteByte('\n')
+	}
+	return n
+}
+
+// redact replaces the value of line, if it is a header to be redacted.
+func (tr *transcriber) redact(line string) string {
+	key, _, ok := strings.Cut(line, ":")
+	if !ok {
+		return line
+	}
+	for _, name := range tr.t.RedactHeaders {
+		if strings.EqualFold(strings.TrimSpace(key), name) {
+			return key + ": REDACTED"
+		}
+	}
+	return line
+}
+
+// writeASCII writes p to b as lines of text, with carriage returns removed
+// and other unprintable bytes shown as '.'.
+func writeASCII(b *bytes.Buffer, p []byte) {
+	for _, c := range p {
+		switch {
+		case c == '\r':
+		case c == '\n', c >= ' ' && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('.')
+		}
+	}
+	if len(p) > 0 && p[len(p)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+}
+
+// transcriptWriter records the bytes written to w.
+type transcriptWriter struct {
+	w  io.Writer
+	tr *transcriber
+}
+
+func (t transcriptWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.tr.mu.Lock()
+	t.tr.record(&t.tr.send, p[:n])
+	t.tr.mu.Unlock()
+	return n, err
+}
+
+// transcriptReader passes the bytes read from r to the transcriber, which
+// records them once they are consumed from the read buffer.
+type transcriptReader struct {
+	r  io.Reader
+	tr *transcriber
+}
+
+func (t transcriptReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.tr.received(p[:n])
+	return n, err
+}
+
+// transcriptBody records the bytes of a response body as they are read.
+type transcriptBody struct {
+	io.Reader
+	tr *transcriber
+}
+
+func (t transcriptBody) Read(p []byte) (int, error) {
+	n, err := t.Reader.Read(p)
+	t.tr.consumed()
+	return n, err
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+var transcriptTests = []struct {
+	Transcript
+	expected string
+}{
+	{
+		Transcript: Transcript{},
+		expected: `12:00:00.000000 => Send header, 75 bytes
+POST /upload HTTP/1.1
+Authorization: Bearer secret
+Content-Length: 11
+
+12:00:00.000000 => Send data, 11 bytes
+hello world
+12:00:00.000000 <= Recv header, 61 bytes
+HTTP/1.1 200 OK
+Content-Length: 7
+Set-Cookie: id=secret
+
+12:00:00.000000 <= Recv data, 6 bytes
+ok
+.ok
+`,
+	},
+	{
+		Transcript: Transcript{MaxBody: 4, RedactHeaders: []string{"authorization", "Set-Cookie"}},
+		expected: `12:00:00.000000 => Send header, 75 bytes
+POST /upload HTTP/1.1
+Authorization: REDACTED
+Content-Length: 11
+
+12:00:00.000000 => Send data, 11 bytes, truncated at 4 bytes
+hell
+12:00:00.000000 <= Recv header, 61 bytes
+HTTP/1.1 200 OK
+Content-Length: 7
+Set-Cookie: REDACTED
+
+12:00:00.000000 <= Recv data, 6 bytes, truncated at 4 bytes
+ok
+.
+`,
+	},
+}
+
+func TestTranscript(t *testing.T) {
+	for _, tt := range transcriptTests {
+		var b bytes.Buffer
+		tt.W = &b
+		rw := readWriter{strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 7\r\nSet-Cookie: id=secret\r\n\r\nok\n\x00ok"), io.Discard}
+		c := NewClient(rw, Transcribe(&tt.Transcript))
+		c.(*client).transcript.now = func() time.Time { return time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC) }
+		req := &Request{
+			Method:  "POST",
+			Path:    "/upload",
+			Version: HTTP_1_1,
+			Headers: []Header{{"Authorization", "Bearer secret"}},
+			Body:    strings.NewReader("hello world"),
+		}
+		if err := c.WriteRequest(req); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.ReadResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		if actual := b.String(); actual != tt.expected {
+			t.Errorf("Transcript{MaxBody: %d, RedactHeaders: %q}: expected\n%s\ngot\n%s", tt.MaxBody, tt.RedactHeaders, tt.expected, actual)
+		}
+	}
+}
+
+// A pipelined response read ahead with the body of the one before it is
+// recorded as a message of its own, with its headers redacted.
+func TestTranscriptPipelined(t *testing.T) {
+	var b bytes.Buffer
+	rw := readWriter{strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nokHTTP/1.1 204 No Content\r\nSet-Cookie: id=secret\r\n\r\n"), io.Discard}
+	c := NewClient(rw, Transcribe(&Transcript{W: &b, MaxBody: 1, RedactHeaders: []string{"Set-Cookie"}}))
+	c.(*client).transcript.now = func() time.Time { return time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC) }
+	for _, code := range []int{200, 204} {
+		if err := c.WriteRequest(&Request{Method: "GET", Path: "/", Version: HTTP_1_1}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.ReadResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != code {
+			t.Fatalf("ReadResponse: expected %d, got %d", code, resp.Code)
+		}
+		if code == 200 {
+			io.Copy(io.Discard, resp.Body)
+		}
+	}
+	expected := `12:00:00.000000 => Send header, 18 bytes
+GET / HTTP/1.1
+
+12:00:00.000000 <= Recv header, 38 bytes
+HTTP/1.1 200 OK
+Content-Length: 2
+
+12:00:00.000000 <= Recv data, 2 bytes, truncated at 1 bytes
+o
+12:00:00.000000 => Send header, 18 bytes
+GET / HTTP/1.1
+
+12:00:00.000000 <= Recv header, 50 bytes
+HTTP/1.1 204 No Content
+Set-Cookie: REDACTED
+
+`
+	if actual := b.String(); actual != expected {
+		t.Errorf("Transcript: expected\n%s\ngot\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import "fmt"
+
+// ValidationError is returned when a request element cannot be written to the
+// wire because it is not valid according to rfc 9110. Writing such an element
+// verbatim, for example a header value containing a CRLF, would allow the
+// injection of additional headers or requests.
+type ValidationError struct {
+	// Element names the invalid element, for example "method" or "header value".
+	Element string
+
+	// Value is the invalid value.
+	Value string
+
+	// Index is the position of the first invalid byte in Value, or -1 if Value
+	// is invalid because it is empty.
+	Index int
+}
+
+func (e *ValidationError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("invalid %s: empty", e.Element)
+	}
+	return fmt.Sprintf("invalid %s %q: invalid character %q at index %d", e.Element, e.Value, e.Value[e.Index:e.Index+1], e.Index)
+}
+
+// validate returns a *ValidationError if s is empty, or contains a byte for which valid returns false.
+func validate(element, s string, valid func(byte) bool) error {
+	if s == "" {
+		return &ValidationError{Element: element, Index: -1}
+	}
+	for i := 0; i < len(s); i++ {
+		if !valid(s[i]) {
+			return &ValidationError{Element: element, Value: s, Index: i}
+		}
+	}
+	return nil
+}
+
+// validRequestLine validates the elements of a request line.
+func validRequestLine(method, path string, query []string, version string) error {
+	if err := validate("method", method, isTokenChar); err != nil {
+		return err
+	}
+	if err := validate("path", path, isTargetChar); err != nil {
+		return err
+	}
+	for _, q := range query {
+		if q == "" {
+			continue
+		}
+		if err := validate("query", q, isTargetChar); err != nil {
+			return err
+		}
+	}
+	return validate("version", version, isTargetChar)
+}
+
+// ValidHeader returns a *ValidationError if key is not a token or value holds
+// a byte which may not appear in a field value. It validates headers and
+// trailers alike.
+func ValidHeader(key, value string) error {
+	if err := validate("header name", key, isTokenChar); err != nil {
+		return err
+	}
+	for i := 0; i < len(value); i++ {
+		if !isFieldValueChar(value[i]) {
+			return &ValidationError{Element: "header value", Value: value, Index: i}
+		}
+	}
+	return nil
+}
+
+// isTokenChar reports whether c is a tchar, rfc 9110 s5.6.2.
+func isTokenChar(c byte) bool {
+	switch {
+	case '0' <= c && c <= '9', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return true
+	}
+	switch c {
+	case '!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~':
+		return true
+	}
+	return false
+}
+
+// isTargetChar reports whether c may appear in a request target, rfc 9112 s3.2.
+// Whitespace, control characters and non ASCII bytes must be percent encoded,
+// and a fragment is never sent.
+func isTargetChar(c byte) bool {
+	return c > 0x20 && c < 0x7f && c != '#'
+}
+
+// isFieldValueChar reports whether c may appear in a field value, rfc 9110 s5.5.
+// CR, LF, NUL and the other control characters, other than HTAB, are rejected.
+func isFieldValueChar(c byte) bool {
+	return c == '\t' || c >= 0x20 && c != 0x7f
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var validRequestLineTests = []struct {
+	method, path string
+	query        []string
+	err          error
+}{
+	{"GET", "/", nil, nil},
+	{"M-SEARCH", "*", nil, nil},
+	{"GET", "http://example.com/foo?bar", nil, nil},
+	{"GET", "/foo%20bar", []string{"a=1", "", "b=%0D%0A"}, nil},
+	{"", "/", nil, errors.New("invalid method: empty")},
+	{"GET /evil HTTP/1.1\r\nHost: evil\r\n\r\nGET", "/", nil, errors.New(`invalid method "GET /evil HTTP/1.1\r\nHost: evil\r\n\r\nGET": invalid character " " at index 3`)},
+	{"G(ET", "/", nil, errors.New(`invalid method "G(ET": invalid character "(" at index 1`)},
+	{"GET", "", nil, errors.New("invalid path: empty")},
+	{"GET", "/foo bar", nil, errors.New(`invalid path "/foo bar": invalid character " " at index 4`)},
+	{"GET", "/\r\nHost: evil", nil, errors.New(`invalid path "/\r\nHost: evil": invalid character "\r" at index 1`)},
+	{"GET", "/foo#bar", nil, errors.New(`invalid path "/foo#bar": invalid character "#" at index 4`)},
+	{"GET", "/caf\xc3\xa9", nil, errors.New(`invalid path "/café": invalid character "\xc3" at index 4`)},
+	{"GET", "/", []string{"a=1\x00"}, errors.New(`invalid query "a=1\x00": invalid character "\x00" at index 3`)},
+}
+
+func TestWriteRequestLineValidation(t *testing.T) {
+	for _, tt := range validRequestLineTests {
+		var b bytes.Buffer
+		w := &writer{Writer: &b}
+		err := w.WriteRequestLine(tt.method, tt.path, tt.query, HTTP_1_1.String())
+		if !sameErr(err, tt.err) {
+			t.Errorf("WriteRequestLine(%q, %q, %q): expected %v, got %v", tt.method, tt.path, tt.query, tt.err, err)
+		}
+	}
+}
+
+var validHeaderTests = []struct {
+	key, value string
+	err        error
+}{
+	{"Host", "localhost", nil},
+	{"X-Empty", "", nil},
+	{"User-Agent", "curl/7.18.0 (i486-pc-linux-gnu)\tlibcurl", nil},
+	{"X-Latin1", "caf\xe9", nil},
+	{"", "value", errors.New("invalid header name: empty")},
+	{"Host:", "localhost", errors.New(`invalid header name "Host:": invalid character ":" at index 4`)},
+	{"X Foo", "bar", errors.New(`invalid header name "X Foo": invalid character " " at index 1`)},
+	{"X-Foo\r\nX-Evil", "bar", errors.New(`invalid header name "X-Foo\r\nX-Evil": invalid character "\r" at index 5`)},
+	{"X-Foo", "bar\r\nX-Evil: yes", errors.New(`invalid header value "bar\r\nX-Evil: yes": invalid character "\r" at index 3`)},
+	{"X-Foo", "bar\nX-Evil: yes", errors.New(`invalid header value "bar\nX-Evil: yes": invalid character "\n" at index 3`)},
+	{"X-Foo", "bar\x00", errors.New(`invalid header value "bar\x00": invalid character "\x00" at index 3`)},
+	{"X-Foo", "bar\x7f", errors.New(`invalid header value "bar\x7f": invalid character "\x7f" at index 3`)},
+}
+
+func TestWriteHeaderValidation(t *testing.T) {
+	for _, tt := range validHeaderTests {
+		var b bytes.Buffer
+		w := &writer{Writer: &b}
+		w.StartHeaders()
+		err := w.WriteHeader(tt.key, tt.value)
+		if !sameErr(err, tt.err) {
+			t.Errorf("WriteHeader(%q, %q): expected %v, got %v", tt.key, tt.value, tt.err, err)
+		}
+		if err != nil && b.Len() > 0 {
+			t.Errorf("WriteHeader(%q, %q): expected nothing to be written, got %q", tt.key, tt.value, b.String())
+		}
+	}
+}
+
+var invalidRequestTests = []Request{
+	{Method: "GET", Path: "/\r\n", Version: HTTP_1_1},
+	{Method: "GET", Path: "/", Version: HTTP_1_1, Headers: []Header{{"Host", "localhost"}, {"X-Evil", "\r\n\r\nGET /evil HTTP/1.1"}}},
+	// headers which exceed the buffer of the writer before the invalid one.
+	{Method: "GET", Path: "/", Version: HTTP_1_1, Headers: []Header{{"X-Big", strings.Repeat("a", 8192)}, {"Bad Name", "b"}}},
+	{Method: "GET", Path: "/", Version: HTTP_1_1, Body: b("hello"), Trailers: func() []Header { return []Header{{"X-Evil", "\r\n"}} }},
+}
+
+func TestClientWriteRequestValidation(t *testing.T) {
+	for _, tt := range invalidRequestTests {
+		var b bytes.Buffer
+		client := NewClient(&b)
+		err := client.WriteRequest(&tt)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("client.WriteRequest(%v): expected %T, got %v", tt, verr, err)
+		}
+		if tt.Trailers == nil && b.Len() > 0 {
+			t.Errorf("client.WriteRequest(%v): expected nothing to be written, got %q", tt, b.String())
+		}
+		// the client is ready for the next request.
+		b.Reset()
+		if err := client.WriteRequest(&Request{Method: "GET", Path: "/", Version: HTTP_1_1}); err != nil {
+			t.Fatalf("client.WriteRequest(%v): next request: %v", tt, err)
+		}
+		if expected := "GET / HTTP/1.1\r\n\r\n"; b.String() != expected {
+			t.Errorf("client.WriteRequest(%v): next request: expected %q, got %q", tt, expected, b.String())
+		}
+	}
+}
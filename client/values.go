@@ -0,0 +1,114 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Value is a single name value pair of a query string or form.
+type Value struct {
+	Name  string
+	Value string
+}
+
+// Values is an ordered list of name value pairs, which may repeat a name. It
+// is encoded as an application/x-www-form-urlencoded query string or body,
+// preserving the order in which the pairs were added.
+type Values []Value
+
+// ParseValues parses an application/x-www-form-urlencoded string, such as a
+// query string or form body, returning the pairs in the order given.
+func ParseValues(s string) (Values, error) {
+	var v Values
+	for s != "" {
+		var pair string
+		pair, s, _ = strings.Cut(s, "&")
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, Value{name, value})
+	}
+	return v, nil
+}
+
+// Add appends the pair name, value.
+func (v *Values) Add(name, value string) {
+	*v = append(*v, Value{name, value})
+}
+
+// Set replaces the value of the first pair with name, removing any others, or
+// appends the pair if there is none.
+func (v *Values) Set(name, value string) {
+	found := false
+	r := (*v)[:0]
+	for _, p := range *v {
+		if p.Name == name {
+			if found {
+				continue
+			}
+			found = true
+			p.Value = value
+		}
+		r = append(r, p)
+	}
+	if !found {
+		r = append(r, Value{name, value})
+	}
+	*v = r
+}
+
+// Del removes every pair with name.
+func (v *Values) Del(name string) {
+	r := (*v)[:0]
+	for _, p := range *v {
+		if p.Name != name {
+			r = append(r, p)
+		}
+	}
+	*v = r
+}
+
+// Get returns the value of the first pair with name, or "" if there is none.
+func (v Values) Get(name string) string {
+	for _, p := range v {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// GetAll returns the values of every pair with name, in order.
+func (v Values) GetAll(name string) []string {
+	var r []string
+	for _, p := range v {
+		if p.Name == name {
+			r = append(r, p.Value)
+		}
+	}
+	return r
+}
+
+// Encode returns the pairs encoded as name=value, escaped and joined by &, for
+// use as a query string or application/x-www-form-urlencoded body.
+func (v Values) Encode() string {
+	return strings.Join(v.Query(), "&")
+}
+
+// Query returns the escaped name=value pairs, suitable for Request.Query.
+func (v Values) Query() []string {
+	q := make([]string, 0, len(v))
+	for _, p := range v {
+		q = append(q, url.QueryEscape(p.Name)+"="+url.QueryEscape(p.Value))
+	}
+	return q
+}
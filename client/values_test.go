@@ -0,0 +1,69 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+var valuesEncodeTests = []struct {
+	values   Values
+	expected string
+}{
+	{nil, ""},
+	{Values{{"q", "go lang"}}, "q=go+lang"},
+	{Values{{"b", "2"}, {"a", "1"}, {"b", "3"}}, "b=2&a=1&b=3"},
+	{Values{{"a&b", "c=d"}, {"e", "100%"}, {"f", ""}}, "a%26b=c%3Dd&e=100%25&f="},
+	{Values{{"path", "/a/b?c#d"}, {"utf8", "é"}}, "path=%2Fa%2Fb%3Fc%23d&utf8=%C3%A9"},
+}
+
+func TestValuesEncode(t *testing.T) {
+	for _, tt := range valuesEncodeTests {
+		if actual := tt.values.Encode(); actual != tt.expected {
+			t.Errorf("Encode(%v): expected %q, got %q", tt.values, tt.expected, actual)
+		}
+		parsed, err := ParseValues(tt.expected)
+		if err != nil || len(parsed) != len(tt.values) || len(parsed) > 0 && !reflect.DeepEqual(parsed, tt.values) {
+			t.Errorf("ParseValues(%q): expected %v, got %v, %v", tt.expected, tt.values, parsed, err)
+		}
+		if err := validRequestLine("GET", "/", tt.values.Query(), "HTTP/1.1"); err != nil {
+			t.Errorf("Query(%v): %v", tt.values, err)
+		}
+	}
+}
+
+var parseValuesTests = []struct {
+	s        string
+	expected Values
+	err      bool
+}{
+	{"a=1&&b&c=", Values{{"a", "1"}, {"b", ""}, {"c", ""}}, false},
+	{"a=%zz", nil, true},
+}
+
+func TestParseValues(t *testing.T) {
+	for _, tt := range parseValuesTests {
+		actual, err := ParseValues(tt.s)
+		if !reflect.DeepEqual(actual, tt.expected) || (err != nil) != tt.err {
+			t.Errorf("ParseValues(%q): expected %v, %v, got %v, %v", tt.s, tt.expected, tt.err, actual, err)
+		}
+	}
+}
+
+func TestValuesSetDel(t *testing.T) {
+	var v Values
+	v.Add("a", "1")
+	v.Add("b", "2")
+	v.Add("a", "3")
+	if v.Get("a") != "1" || !reflect.DeepEqual(v.GetAll("a"), []string{"1", "3"}) || v.Get("z") != "" {
+		t.Errorf("Get: unexpected %v", v)
+	}
+	v.Set("a", "4")
+	if expected := (Values{{"a", "4"}, {"b", "2"}}); !reflect.DeepEqual(v, expected) {
+		t.Errorf("Set: expected %v, got %v", expected, v)
+	}
+	v.Set("c", "5")
+	v.Del("b")
+	if expected := (Values{{"a", "4"}, {"c", "5"}}); !reflect.DeepEqual(v, expected) {
+		t.Errorf("Del: expected %v, got %v", expected, v)
+	}
+}
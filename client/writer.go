@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"net/http/httputil"
 	"strings"
 )
 
@@ -40,17 +39,22 @@ func (p *phaseError) Error() string {
 type writer struct {
 	phase
 	io.Writer
-	tmp io.Writer // used to hold the original writer during the headers phase.
+	tmp       io.Writer // used to hold the original writer during the headers phase.
+	chunkSize int       // the largest chunk written by WriteChunked.
 }
 
 // StartHeaders moves the Conn into the headers phase
 func (w *writer) StartHeaders() { w.phase = header }
 
-// WriteRequestLine writes the RequestLine and moves the Conn to the headers phase
+// WriteRequestLine writes the RequestLine and moves the Conn to the headers phase.
+// If the method, path, query or version are not valid a *ValidationError is returned.
 func (w *writer) WriteRequestLine(method, path string, query []string, version string) error {
 	if w.phase != requestline {
 		return &phaseError{requestline, w.phase}
 	}
+	if err := validRequestLine(method, path, query, version); err != nil {
+		return err
+	}
 	q := strings.Join(query, "&")
 	if len(q) > 0 {
 		q = "?" + q
@@ -61,11 +65,15 @@ func (w *writer) WriteRequestLine(method, path string, query []string, version s
 	return err
 }
 
-// WriteHeader writes the canonical header form to the wire.
+// WriteHeader writes the canonical header form to the wire. If the key or value
+// are not valid a *ValidationError is returned.
 func (w *writer) WriteHeader(key, value string) error {
 	if w.phase != header {
 		return &phaseError{header, w.phase}
 	}
+	if err := ValidHeader(key, value); err != nil {
+		return err
+	}
 	_, err := fmt.Fprintf(w, "%s: %s\r\n", key, value)
 	return err
 }
@@ -91,15 +99,48 @@ func (w *writer) WriteBody(r io.Reader) error {
 	return err
 }
 
+// writeBodyLength writes the contents of r, which must be exactly length bytes,
+// to the wire. No more than length bytes are written, so a longer body cannot
+// be mistaken by the server for a further request.
+func (w *writer) writeBodyLength(r io.Reader, length int64) error {
+	if w.phase != body {
+		return &phaseError{body, w.phase}
+	}
+	n, err := io.Copy(w, io.LimitReader(r, length))
+	w.phase = requestline
+	switch {
+	case err != nil:
+		return err
+	case n < length:
+		return fmt.Errorf("Content-Length %d with body length %d", length, n)
+	}
+	var b [1]byte
+	if n, _ := io.ReadFull(r, b[:]); n > 0 {
+		return fmt.Errorf("Content-Length %d with longer body", length)
+	}
+	return nil
+}
+
 // WriteChunked writes the contents of r in chunked format to the wire.
 func (w *writer) WriteChunked(r io.Reader) error {
+	return w.WriteChunkedTrailers(r, nil)
+}
+
+// WriteChunkedTrailers writes the contents of r in chunked format to the wire,
+// followed by the trailer fields returned by trailers. trailers, if non nil, is
+// called once r has been consumed.
+func (w *writer) WriteChunkedTrailers(r io.Reader, trailers func() []Header) error {
 	if w.phase != body {
 		return &phaseError{body, w.phase}
 	}
-	cw := httputil.NewChunkedWriter(w)
+	cw := NewChunkedWriter(w, w.chunkSize)
 	if _, err := io.Copy(cw, r); err != nil {
-		return nil
+		return err
 	}
 	w.phase = requestline
-	return cw.Close()
+	var t []Header
+	if trailers != nil {
+		t = trailers()
+	}
+	return cw.CloseWithTrailers(t)
 }
@@ -3,6 +3,8 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"strings"
 	"testing"
@@ -219,8 +221,8 @@ var writeChunkedTests = []struct {
 	io.Reader
 	expected string
 }{
-	{strings.NewReader(""), "0\r\n"},
-	{strings.NewReader("all your base are belong to us"), "1e\r\nall your base are belong to us\r\n0\r\n"},
+	{strings.NewReader(""), "0\r\n\r\n"},
+	{strings.NewReader("all your base are belong to us"), "1e\r\nall your base are belong to us\r\n0\r\n\r\n"},
 }
 
 func TestWriteChunked(t *testing.T) {
@@ -236,6 +238,51 @@ func TestWriteChunked(t *testing.T) {
 	}
 }
 
+var writeChunkedTrailersTests = []struct {
+	io.Reader
+	trailers func() []Header
+	expected string
+}{
+	{strings.NewReader(""), nil, "0\r\n\r\n"},
+	{strings.NewReader(""), func() []Header { return nil }, "0\r\n\r\n"},
+	{
+		strings.NewReader("hello"),
+		func() []Header { return []Header{{"Checksum", "1234"}, {"Expires", "never"}} },
+		"5\r\nhello\r\n0\r\nChecksum: 1234\r\nExpires: never\r\n\r\n",
+	},
+}
+
+func TestWriteChunkedTrailers(t *testing.T) {
+	for _, tt := range writeChunkedTrailersTests {
+		var b bytes.Buffer
+		w := &writer{Writer: &b, phase: body}
+		if err := w.WriteChunkedTrailers(tt.Reader, tt.trailers); err != nil {
+			t.Fatal(err)
+		}
+		if actual := b.String(); actual != tt.expected {
+			t.Errorf("WriteChunkedTrailers: expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
+// trailers computed from the body are available once the body is written.
+func TestWriteChunkedComputedTrailers(t *testing.T) {
+	var b bytes.Buffer
+	w := &writer{Writer: &b, phase: body}
+	h := crc32.NewIEEE()
+	r := io.TeeReader(strings.NewReader("hello"), h)
+	trailers := func() []Header {
+		return []Header{{"Checksum", fmt.Sprintf("%08x", h.Sum32())}}
+	}
+	if err := w.WriteChunkedTrailers(r, trailers); err != nil {
+		t.Fatal(err)
+	}
+	expected := "5\r\nhello\r\n0\r\nChecksum: 3610a686\r\n\r\n"
+	if actual := b.String(); actual != expected {
+		t.Errorf("WriteChunkedTrailers: expected %q, got %q", expected, actual)
+	}
+}
+
 var headerBufferingTests = []struct {
 	f func(*writer) error
 	n int
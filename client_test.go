@@ -3,15 +3,20 @@ package http
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gorilla/http/client"
 )
@@ -106,13 +111,9 @@ var clientDoTests = []struct {
 			Reason: "OK",
 		},
 		headers: map[string][]string{"Accept-Encoding": []string{"gzip"}},
-		rheaders: map[string][]string{
-			// net/http can buffer the first write to avoid chunked
-			"Content-Length":   []string{"48"},
-			"Content-Encoding": []string{"gzip"},
-			// "Content-Type":     []string{"application/x-gzip"},
-		},
-		rbody: strings.NewReader(a()),
+		// Content-Encoding and Content-Length are removed once decoded.
+		rheaders: map[string][]string{},
+		rbody:    strings.NewReader(a()),
 	},
 	{
 		Client: Client{dialer: new(dialer)},
@@ -219,6 +220,21 @@ func stdmux() *http.ServeMux {
 	mux.HandleFunc("/302", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "200", http.StatusFound)
 	})
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			log.Fatal(err)
+		}
+		http.Error(w, "Created", http.StatusCreated)
+	})
+	mux.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte(r.Proto)); err != nil {
+			log.Fatal(err)
+		}
+	})
 	mux.HandleFunc("/query1", func(w http.ResponseWriter, r *http.Request) {
 		rq := r.URL.RawQuery
 		if rq != "a=1" {
@@ -290,6 +306,60 @@ func readBody(t *testing.T, r io.Reader) string {
 	return b.String()
 }
 
+var clientExpectContinueTests = []struct {
+	headers map[string][]string
+	client.Status
+	read int // bytes of the body read by the client
+}{
+	{
+		Status: client.Status{
+			Code:   401,
+			Reason: "Unauthorized",
+		},
+		read: 0,
+	},
+	{
+		headers: map[string][]string{"Authorization": {"Bearer banana"}},
+		Status: client.Status{
+			Code:   201,
+			Reason: "Created",
+		},
+		read: len(postBody),
+	},
+}
+
+func TestClientExpectContinue(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+	for _, tt := range clientExpectContinueTests {
+		c := &Client{dialer: new(dialer), ExpectContinue: time.Second}
+		body := strings.NewReader(postBody)
+		status, _, r, err := c.Put(s.Root()+"/auth", tt.headers, body)
+		if err != nil {
+			t.Fatalf("Client.Put(%q, %v): %v", "/auth", tt.headers, err)
+		}
+		r.Close()
+		if status != tt.Status {
+			t.Errorf("Client.Put(%q, %v): status expected %v, got %v", "/auth", tt.headers, tt.Status, status)
+		}
+		if read := len(postBody) - body.Len(); read != tt.read {
+			t.Errorf("Client.Put(%q, %v): expected %d bytes of body to be sent, got %d", "/auth", tt.headers, tt.read, read)
+		}
+	}
+}
+
+func TestClientDoHeaderInjection(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+	c := &Client{dialer: new(dialer)}
+	headers := map[string][]string{"X-Evil": {"yes\r\n\r\nGET /404 HTTP/1.1"}}
+	_, _, _, err := c.Get(s.Root()+"/200", headers)
+	var verr *client.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Client.Get(%q, %v): expected %T, got %v", "/200", headers, verr, err)
+	}
+}
+
 var clientGetTests = []struct {
 	path    string
 	headers map[string][]string
@@ -347,6 +417,25 @@ var clientPostTests = []struct {
 			Reason: "Created",
 		},
 	},
+	{
+		path: "/201",
+		// hide the length of the body, forcing chunked encoding
+		body: func() io.Reader { return struct{ io.Reader }{strings.NewReader(postBody)} },
+		Status: client.Status{
+			Code:   201,
+			Reason: "Created",
+		},
+	},
+	{
+		path: "/201",
+		// the length of the body is supplied by the caller, avoiding chunked encoding
+		headers: map[string][]string{"Content-Length": {fmt.Sprint(len(postBody))}},
+		body:    func() io.Reader { return struct{ io.Reader }{strings.NewReader(postBody)} },
+		Status: client.Status{
+			Code:   201,
+			Reason: "Created",
+		},
+	},
 	{
 		path: "/404",
 		Status: client.Status{
@@ -376,6 +465,36 @@ func TestClientPost(t *testing.T) {
 	}
 }
 
+// the headers of a request are not changed by sending it.
+func TestClientPostHeaders(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+	c := &Client{dialer: new(dialer)}
+	headers := map[string][]string{"Content-Length": {fmt.Sprint(len(postBody))}}
+	_, _, r, err := c.Post(s.Root()+"/201", headers, struct{ io.Reader }{strings.NewReader(postBody)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	expected := map[string][]string{"Content-Length": {fmt.Sprint(len(postBody))}}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("Client.Post: expected headers %v, got %v", expected, headers)
+	}
+}
+
+// a body which does not match its Content-Length fails the request.
+func TestClientPostLengthMismatch(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+	for _, body := range []string{"hello", "hello world"} {
+		c := &Client{dialer: new(dialer)}
+		headers := map[string][]string{"Content-Length": {"8"}}
+		if _, _, _, err := c.Post(s.Root()+"/404", headers, struct{ io.Reader }{strings.NewReader(body)}); err == nil {
+			t.Errorf("Client.Post(%q): expected error", body)
+		}
+	}
+}
+
 var clientPutTests = []struct {
 	path    string
 	headers map[string][]string
@@ -518,7 +637,7 @@ var statusErrorTests = []struct {
 
 func TestStatusError(t *testing.T) {
 	for _, tt := range statusErrorTests {
-		err := &StatusError{tt.Status}
+		err := &StatusError{Status: tt.Status}
 		if !sameErr(err, tt.err) {
 			t.Errorf("StatusError{%q}: expected %v, got %v", tt.Status, tt.err, err)
 		}
@@ -605,6 +724,34 @@ func sameBody(t *testing.T, a, b io.Reader) (bool, string, string) {
 	return bytes.Equal(A.Bytes(), B.Bytes()), A.String(), B.String()
 }
 
+var requestLengthTests = []struct {
+	headers  map[string][]string
+	expected int64
+	err      error
+}{
+	{nil, 0, nil},
+	{map[string][]string{"Host": {"localhost"}}, 0, nil},
+	{map[string][]string{"Content-Length": {"10"}}, 10, nil},
+	{map[string][]string{"content-length": {"10"}}, 10, nil},
+	{map[string][]string{"Content-Length": {"ten"}}, 0, errors.New(`invalid Content-Length: "ten"`)},
+	{map[string][]string{"Content-Length": {"-1"}}, 0, errors.New(`invalid Content-Length: "-1"`)},
+	{map[string][]string{"Content-Length": {"1", "2"}}, 0, errors.New(`invalid Content-Length: ["1" "2"]`)},
+}
+
+func TestRequestLength(t *testing.T) {
+	for _, tt := range requestLengthTests {
+		actual, err := requestLength(tt.headers)
+		if actual != tt.expected || !sameErr(err, tt.err) {
+			t.Errorf("requestLength(%v): expected %d %v, got %d %v", tt.headers, tt.expected, tt.err, actual, err)
+		}
+		for k := range tt.headers {
+			if strings.EqualFold(k, "Content-Length") {
+				t.Errorf("requestLength(%v): Content-Length header was not removed", tt.headers)
+			}
+		}
+	}
+}
+
 var headerValueTests = []struct {
 	headers       map[string][]string
 	key, expected string
@@ -682,3 +829,131 @@ func TestFirstErr(t *testing.T) {
 		}
 	}
 }
+
+// newTLSServer starts a net/http https server which supports HTTP/2.
+func newTLSServer(t *testing.T, mux *http.ServeMux) *httptest.Server {
+	s := httptest.NewUnstartedServer(mux)
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+var clientHTTPSTests = []struct {
+	http2      bool
+	nextProtos []string
+	expected   string
+}{
+	{false, nil, "HTTP/1.1"},
+	{true, nil, "HTTP/2.0"},
+	// h2 is not offered unless HTTP2 is set.
+	{false, []string{"h2", "http/1.1"}, "HTTP/1.1"},
+}
+
+func TestClientHTTPS(t *testing.T) {
+	s := newTLSServer(t, stdmux())
+	for _, tt := range clientHTTPSTests {
+		d := new(dialer)
+		c := &Client{dialer: d, TLSConfig: &tls.Config{InsecureSkipVerify: true, NextProtos: tt.nextProtos}, HTTP2: tt.http2}
+		for i := 0; i < 3; i++ {
+			status, _, r, err := c.Get(s.URL+"/proto", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := readBody(t, r); !status.IsSuccess() || actual != tt.expected {
+				t.Errorf("Client{HTTP2: %v}.Get: expected %q, got %v %q", tt.http2, tt.expected, status, actual)
+			}
+			r.Close()
+		}
+		status, _, r, err := c.Post(s.URL+"/201", nil, strings.NewReader(postBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if status.Code != 201 {
+			t.Errorf("Client{HTTP2: %v}.Post: expected 201, got %v", tt.http2, status)
+		}
+		if expected := map[bool]int{false: 0, true: 1}[tt.http2]; len(d.h2) != expected {
+			t.Errorf("Client{HTTP2: %v}: expected %d shared connections, got %d", tt.http2, expected, len(d.h2))
+		}
+	}
+}
+
+// requests made concurrently share one HTTP/2 connection.
+func TestClientHTTP2Concurrent(t *testing.T) {
+	s := newTLSServer(t, stdmux())
+	d := new(dialer)
+	c := &Client{dialer: d, TLSConfig: &tls.Config{InsecureSkipVerify: true}, HTTP2: true}
+	// establish the connection before sharing it.
+	if _, _, r, err := c.Get(s.URL+"/200", nil); err != nil {
+		t.Fatal(err)
+	} else {
+		r.Close()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			_, _, r, err := c.Get(s.URL+"/a", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer r.Close()
+			if _, err := io.Copy(&buf, r); err != nil || buf.String() != a() {
+				t.Errorf("Get: expected %d bytes, got %d %v", len(a()), buf.Len(), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(d.h2) != 1 {
+		t.Errorf("expected 1 shared connection, got %d", len(d.h2))
+	}
+	if s := c.Stats()["tls:"+strings.TrimPrefix(s.URL, "https://")]; s.Dialed != 1 || s.Reused != 20 || s.Active != 1 {
+		t.Errorf("Stats: expected 1 dialed, 20 reused and 1 active, got %+v", s)
+	}
+}
+
+// TestClientH2C speaks HTTP/2 with prior knowledge to a proxy which forwards
+// it, over TLS, to a server supporting HTTP/2.
+func TestClientH2C(t *testing.T) {
+	s := newTLSServer(t, stdmux())
+	l, err := net.ListenTCP("tcp4", localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tc, err := tls.Dial("tcp", s.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+			if err != nil {
+				c.Close()
+				continue
+			}
+			go func() { io.Copy(tc, c); tc.Close() }()
+			go func() { io.Copy(c, tc); c.Close() }()
+		}
+	}()
+	c := &Client{dialer: new(dialer), H2C: true}
+	status, _, r, err := c.Get(fmt.Sprintf("http://%s/proto", l.Addr()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if actual := readBody(t, r); !status.IsSuccess() || actual != "HTTP/2.0" {
+		t.Errorf("Client{H2C: true}.Get: expected %q, got %v %q", "HTTP/2.0", status, actual)
+	}
+}
+
+func TestClientUnsupportedScheme(t *testing.T) {
+	c := &Client{dialer: new(dialer)}
+	if _, _, _, err := c.Get("ftp://example.com/", nil); err == nil {
+		t.Error("Get: expected error, got nil")
+	}
+}
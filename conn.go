@@ -1,14 +1,21 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/gorilla/http/client"
+	"github.com/gorilla/http/client/http2"
 )
 
+// errBodyClosed is returned when reading a response body after it has been closed.
+var errBodyClosed = errors.New("http: read on closed response body")
+
 // Dialer can dial a remote HTTP server.
 type Dialer interface {
 	// Dial dials a remote http server returning a Conn.
@@ -16,30 +23,369 @@ type Dialer interface {
 }
 
 type dialer struct {
-	sync.Mutex                   // protects following fields
-	conns      map[string][]Conn // maps addr to a, possibly empty, slice of existing Conns
+	sync.Mutex                        // protects following fields
+	conns      map[string][]Conn      // maps addr to a, possibly empty, slice of existing Conns
+	h2         map[string]*http2.Conn // maps addr to a HTTP/2 connection shared by all requests
+	counters   map[string]*poolStats  // maps addr to the statistics of its pool
+	hooks      PoolHooks
 }
 
 func (d *dialer) Dial(network, addr string) (Conn, error) {
+	return d.dialContext(context.Background(), network, addr)
+}
+
+// contextDialer is implemented by Dialers which can be cancelled and traced
+// using a context.
+type contextDialer interface {
+	dialContext(ctx context.Context, network, addr string) (Conn, error)
+}
+
+func (d *dialer) dialContext(ctx context.Context, network, addr string) (Conn, error) {
+	traceGetConn(ctx, addr)
+	if conn := d.pooled(ctx, addr); conn != nil {
+		return conn, nil
+	}
+	done := d.dialing(addr)
+	c, err := dialTCP(ctx, network, addr)
+	done()
+	if err != nil {
+		return nil, err
+	}
+	d.dialed(addr, c, false)
+	gotConn(ctx, addr, c, false)
+	return &conn{
+		Client: client.NewClient(c),
+		Conn:   c,
+		dialer: d,
+		key:    addr,
+	}, nil
+}
+
+// dialTCP dials addr. If ctx carries a Trace the host is looked up, and its
+// addresses dialed, here, so each phase may be traced. As by net.Dialer, the
+// addresses of the family of the first are dialed in turn, and if they have
+// not connected after fallbackDelay the others are dialed in parallel, rfc
+// 8305.
+func dialTCP(ctx context.Context, network, addr string) (net.Conn, error) {
+	t := client.ContextTrace(ctx)
+	if t == nil {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs := []net.IPAddr{{}}
+	if ip := net.ParseIP(host); ip != nil {
+		addrs[0].IP = ip
+	} else {
+		if t.DNSStart != nil {
+			t.DNSStart(host)
+		}
+		addrs, err = net.DefaultResolver.LookupIPAddr(ctx, host)
+		if t.DNSDone != nil {
+			t.DNSDone(addrs, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	var primaries, fallbacks []string
+	for _, a := range addrs {
+		if (a.IP.To4() != nil) == (addrs[0].IP.To4() != nil) {
+			primaries = append(primaries, net.JoinHostPort(a.String(), port))
+		} else {
+			fallbacks = append(fallbacks, net.JoinHostPort(a.String(), port))
+		}
+	}
+	return dialParallel(ctx, t, network, primaries, fallbacks)
+}
+
+// fallbackDelay is how long the primary addresses are dialed alone, as by
+// net.Dialer.
+const fallbackDelay = 300 * time.Millisecond
+
+// dialParallel dials primaries in turn, and if none has connected after
+// fallbackDelay, or all have failed, fallbacks in parallel, returning the
+// first conn established.
+func dialParallel(ctx context.Context, t *client.Trace, network string, primaries, fallbacks []string) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return dialSerial(ctx, t, network, primaries)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	results := make(chan result)
+	dial := func(addrs []string) {
+		c, err := dialSerial(ctx, t, network, addrs)
+		results <- result{c, err}
+	}
+	go dial(primaries)
+	dialing, fellBack := 1, false
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if !fellBack {
+				go dial(fallbacks)
+				dialing, fellBack = dialing+1, true
+			}
+		case r := <-results:
+			dialing--
+			if r.err == nil {
+				// the other dial is cancelled, but may yet connect.
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.c != nil {
+							r.c.Close()
+						}
+					}
+				}(dialing)
+				return r.c, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if !fellBack {
+				go dial(fallbacks)
+				dialing, fellBack = dialing+1, true
+			} else if dialing == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// dialSerial dials each of addrs in turn, returning the first conn
+// established, or the last error.
+func dialSerial(ctx context.Context, t *client.Trace, network string, addrs []string) (net.Conn, error) {
+	var d net.Dialer
+	var err error
+	for _, addr := range addrs {
+		if t.ConnectStart != nil {
+			t.ConnectStart(network, addr)
+		}
+		var c net.Conn
+		c, err = d.DialContext(ctx, network, addr)
+		if t.ConnectDone != nil {
+			t.ConnectDone(network, addr, err)
+		}
+		if err == nil {
+			return c, nil
+		}
+	}
+	return nil, err
+}
+
+// pooled returns an existing Conn to the pool key, or nil if there is none.
+func (d *dialer) pooled(ctx context.Context, key string) Conn {
 	d.Lock()
 	if d.conns == nil {
 		d.conns = make(map[string][]Conn)
 	}
-	if c, ok := d.conns[addr]; ok {
-		if len(c) > 0 {
-			conn := c[0]
-			c[0], c = c[len(c)-1], c[:len(c)-1] // nolint:staticcheck
-			d.Unlock()
-			return conn, nil
-		}
+	c := d.conns[key]
+	if len(c) == 0 {
+		d.Unlock()
+		return nil
 	}
+	// the most recently released conn is the least likely to have been closed by the server.
+	pc := c[len(c)-1]
+	c[len(c)-1] = nil
+	d.conns[key] = c[:len(c)-1]
+	p := d.pool(key)
+	p.reused++
+	p.active++
+	h := d.hooks.OnReuse
 	d.Unlock()
-	c, err := net.Dial(network, addr)
+	cc, ok := pc.(*conn)
+	if ok {
+		cc.reused = true
+		d.hook(h, key, cc.Conn)
+		gotConn(ctx, key, cc.Conn, true)
+	}
+	return pc
+}
+
+// tlsDialer is implemented by Dialers which support https and HTTP/2.
+type tlsDialer interface {
+	// dialTLS dials addr using TLS. If h2 is set, HTTP/2 is offered using ALPN
+	// and, if the server accepts, a shared *http2.Conn is returned in place
+	// of a Conn. Otherwise h2 is removed from the protocols offered.
+	dialTLS(ctx context.Context, addr string, config *tls.Config, h2 bool) (Conn, *http2.Conn, error)
+
+	// dialH2C returns a shared *http2.Conn to addr using HTTP/2 over plain
+	// TCP with prior knowledge.
+	dialH2C(ctx context.Context, addr string) (*http2.Conn, error)
+}
+
+func (d *dialer) dialTLS(ctx context.Context, addr string, config *tls.Config, h2 bool) (Conn, *http2.Conn, error) {
+	// HTTP/1.1 connections over TLS are pooled separately from plain connections to addr.
+	key := "tls:" + addr
+	traceGetConn(ctx, addr)
+	if h2 {
+		if c := d.sharedHTTP2(ctx, key); c != nil {
+			return nil, c, nil
+		}
+	}
+	if conn := d.pooled(ctx, key); conn != nil {
+		return conn, nil, nil
+	}
+	if config == nil {
+		config = new(tls.Config)
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.ServerName = host
+	}
+	if h2 && len(config.NextProtos) == 0 {
+		config.NextProtos = []string{http2.NextProto, "http/1.1"}
+	} else if !h2 {
+		// HTTP/2 must not be negotiated on a conn which will speak HTTP/1.1.
+		config.NextProtos = withoutProto(config.NextProtos, http2.NextProto)
+	}
+	done := d.dialing(key)
+	c, err := dialTLS(ctx, addr, config)
+	done()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.ConnectionState().NegotiatedProtocol == http2.NextProto {
+		if !h2 {
+			c.Close()
+			return nil, nil, errors.New("http: server negotiated HTTP/2, which was not offered")
+		}
+		h2c, err := d.addHTTP2(ctx, key, c)
+		return nil, h2c, err
+	}
+	d.dialed(key, c, false)
+	gotConn(ctx, key, c, false)
 	return &conn{
 		Client: client.NewClient(c),
 		Conn:   c,
 		dialer: d,
-	}, err
+		key:    key,
+	}, nil, nil
+}
+
+// withoutProto returns protos without proto.
+func withoutProto(protos []string, proto string) []string {
+	var p []string
+	for _, v := range protos {
+		if v != proto {
+			p = append(p, v)
+		}
+	}
+	return p
+}
+
+// dialTLS dials addr and performs the TLS handshake.
+func dialTLS(ctx context.Context, addr string, config *tls.Config) (*tls.Conn, error) {
+	c, err := dialTCP(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := client.ContextTrace(ctx)
+	if t != nil && t.TLSHandshakeStart != nil {
+		t.TLSHandshakeStart()
+	}
+	tc := tls.Client(c, config)
+	err = tc.HandshakeContext(ctx)
+	if t != nil && t.TLSHandshakeDone != nil {
+		t.TLSHandshakeDone(tc.ConnectionState(), err)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+func (d *dialer) dialH2C(ctx context.Context, addr string) (*http2.Conn, error) {
+	key := "h2c:" + addr
+	traceGetConn(ctx, addr)
+	if c := d.sharedHTTP2(ctx, key); c != nil {
+		return c, nil
+	}
+	done := d.dialing(key)
+	c, err := dialTCP(ctx, "tcp", addr)
+	done()
+	if err != nil {
+		return nil, err
+	}
+	return d.addHTTP2(ctx, key, c)
+}
+
+// sharedHTTP2 returns the HTTP/2 connection to the pool key, if it can take
+// new requests.
+func (d *dialer) sharedHTTP2(ctx context.Context, key string) *http2.Conn {
+	d.Lock()
+	c := d.h2[key]
+	if c == nil {
+		d.Unlock()
+		return nil
+	}
+	p := d.pool(key)
+	nc := p.h2
+	if !c.Available() {
+		delete(d.h2, key)
+		p.h2 = nil
+		p.closed++
+		p.evicted++
+		evict, close := d.hooks.OnEvict, d.hooks.OnClose
+		d.Unlock()
+		c.Close()
+		d.hook(evict, key, nc)
+		d.hook(close, key, nc)
+		logEvent(ctx, levelDebug, "evicted connection", "pool", key, "reason", "no new streams")
+		return nil
+	}
+	p.reused++
+	h := d.hooks.OnReuse
+	d.Unlock()
+	d.hook(h, key, nc)
+	gotConn(ctx, key, nc, true)
+	return c
+}
+
+// addHTTP2 starts a HTTP/2 connection over c and shares it under key. If
+// another request has already done so, c is closed and that connection used.
+func (d *dialer) addHTTP2(ctx context.Context, key string, c net.Conn) (*http2.Conn, error) {
+	h2c, err := http2.NewConn(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	d.dialed(key, c, true)
+	d.Lock()
+	if d.h2 == nil {
+		d.h2 = make(map[string]*http2.Conn)
+	}
+	p := d.pool(key)
+	if existing := d.h2[key]; existing != nil && existing.Available() {
+		p.closed++
+		h, nc := d.hooks.OnClose, p.h2
+		d.Unlock()
+		h2c.Close()
+		d.hook(h, key, c)
+		gotConn(ctx, key, nc, true)
+		return existing, nil
+	}
+	d.h2[key] = h2c
+	p.h2 = c
+	d.Unlock()
+	gotConn(ctx, key, c, false)
+	return h2c, nil
 }
 
 // Conn represnts a connection which can be used to communicate
@@ -60,11 +406,201 @@ type conn struct {
 	client.Client
 	net.Conn
 	*dialer
+	key    string // the pool to which the conn is released
+	reused bool   // the conn was taken from the pool
+	closed bool   // protected by the dialer
 }
 
 func (c *conn) Release() {
-	c.dialer.Lock()
-	defer c.dialer.Unlock()
-	addr := c.Conn.RemoteAddr().String()
-	c.dialer.conns[addr] = append(c.dialer.conns[addr], c)
+	d := c.dialer
+	d.Lock()
+	d.conns[c.key] = append(d.conns[c.key], c)
+	d.pool(c.key).active--
+	h := d.hooks.OnRelease
+	d.Unlock()
+	d.hook(h, c.key, c.Conn)
+}
+
+func (c *conn) Close() error {
+	c.closing(false)
+	return c.Conn.Close()
+}
+
+// closing counts c as closed, and evicted if evict is set.
+func (c *conn) closing(evict bool) {
+	d := c.dialer
+	d.Lock()
+	if c.closed {
+		d.Unlock()
+		return
+	}
+	c.closed = true
+	p := d.pool(c.key)
+	p.active--
+	p.closed++
+	onEvict := d.hooks.OnEvict
+	if evict {
+		p.evicted++
+	} else {
+		onEvict = nil
+	}
+	onClose := d.hooks.OnClose
+	d.Unlock()
+	d.hook(onEvict, c.key, c.Conn)
+	d.hook(onClose, c.key, c.Conn)
+}
+
+// evict closes c, which was found to be unusable.
+func evict(c Conn) error {
+	cc, ok := c.(*conn)
+	if !ok {
+		return c.Close()
+	}
+	cc.closing(true)
+	return cc.Conn.Close()
+}
+
+// setTranscript sets the transcript of c, if it supports one.
+func setTranscript(c Conn, t *client.Transcript) {
+	cc, ok := c.(*conn)
+	if !ok {
+		return
+	}
+	if tc, ok := cc.Client.(interface{ SetTranscript(*client.Transcript) }); ok {
+		tc.SetTranscript(t)
+	}
+}
+
+// poolKey returns the name of the pool of c, which was dialed to addr.
+func poolKey(c Conn, addr string) string {
+	if cc, ok := c.(*conn); ok {
+		return cc.key
+	}
+	return addr
+}
+
+// reused reports whether c was taken from the pool, rather than newly dialed.
+func reused(c Conn) bool {
+	cc, ok := c.(*conn)
+	return ok && cc.reused
+}
+
+const (
+	// maxDrain is the most of the unread remainder of a response body which
+	// is read when it is closed, so its connection may be reused.
+	maxDrain = 64 << 10
+
+	// drainTimeout is the longest spent reading the remainder.
+	drainTimeout = 100 * time.Millisecond
+)
+
+// connBody is the body of a response read from a HTTP/1.x Conn. Once the body
+// has been read to EOF the Conn is released for reuse, if the response allows
+// it, otherwise closed.
+type connBody struct {
+	r     io.Reader
+	conn  Conn
+	reuse bool // the conn may be reused once the body has been read
+
+	// ctx and pool identify the request for logging.
+	ctx  context.Context
+	pool string
+
+	mu      sync.Mutex // protects following fields
+	reading bool       // a Read is in progress
+	eof     bool
+	closed  bool // Close has been called
+	done    bool // the conn has been released or closed
+}
+
+func (b *connBody) Read(buf []byte) (int, error) {
+	b.mu.Lock()
+	switch {
+	case b.eof:
+		b.mu.Unlock()
+		return 0, io.EOF
+	case b.closed || b.done:
+		b.mu.Unlock()
+		return 0, errBodyClosed
+	}
+	b.reading = true
+	b.mu.Unlock()
+
+	n, err := b.r.Read(buf)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reading = false
+	switch {
+	case b.closed:
+		return n, errBodyClosed // closed by Close during the Read.
+	case err == io.EOF:
+		b.eof = true
+		b.finish(b.reuse)
+	case err != nil:
+		b.finish(false)
+	}
+	return n, err
+}
+
+// Close closes the body. If the body was not read to EOF up to 64k of the
+// remainder is read, so the Conn may still be reused. If a Read is in
+// progress the Conn is closed, ending the Read. Close may be called more than
+// once.
+func (b *connBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	switch {
+	case b.done:
+		return nil
+	case b.reading:
+		b.done = true
+		return b.conn.Close()
+	}
+	if b.reuse {
+		b.conn.SetReadDeadline(time.Now().Add(drainTimeout))
+		_, err := io.CopyN(io.Discard, b.r, maxDrain+1)
+		b.conn.SetReadDeadline(time.Time{})
+		if err == io.EOF {
+			return b.finish(true)
+		}
+	}
+	return b.finish(false)
+}
+
+// finish releases the conn if reuse is set, otherwise closes it.
+func (b *connBody) finish(reuse bool) error {
+	b.done = true
+	if reuse {
+		b.conn.Release()
+		logEvent(b.ctx, levelDebug, "released connection", "pool", b.pool)
+		return nil
+	}
+	logEvent(b.ctx, levelDebug, "closed connection", "pool", b.pool)
+	return b.conn.Close()
+}
+
+// reusable reports whether the connection on which req was sent and resp
+// received may be reused once the body of resp has been read.
+func reusable(req *client.Request, resp *client.Response) bool {
+	switch {
+	case resp.Version != client.HTTP_1_1, resp.CloseRequested():
+		return false
+	case resp.IsInformational():
+		// after 101 Switching Protocols the conn no longer speaks HTTP, and
+		// any other 1xx response is followed by the final one.
+		return false
+	case req.ExpectContinue() && req.Body != nil:
+		// the body may not have been sent.
+		return false
+	case !hasBody(req.Method, resp.Status):
+		return true
+	default:
+		// otherwise the body is delimited by the connection closing.
+		return resp.ContentLength() >= 0 || resp.TransferEncoding() == "chunked"
+	}
 }
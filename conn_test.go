@@ -1,7 +1,17 @@
 package http
 
 import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gorilla/http/client"
 )
 
 var _ Conn = new(conn)
@@ -71,3 +81,336 @@ func TestDialCounts(t *testing.T) {
 		}
 	}
 }
+
+// countingListener counts the connections accepted.
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return c, err
+}
+
+func (l *countingListener) count() int { return int(atomic.LoadInt32(&l.accepted)) }
+
+func reusemux() *http.ServeMux {
+	mux := limitmux()
+	mux.HandleFunc("/close", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		w.Write([]byte("bye"))
+	})
+	return mux
+}
+
+var connReuseTests = []struct {
+	method string
+	path   string
+	read   int64 // bytes of the body to read before closing, -1 to read to EOF without closing
+	conns  int   // connections expected for three requests
+}{
+	{"GET", "/size?n=100", -1, 1},
+	{"GET", "/size?n=100&chunked=1", -1, 1},
+	{"GET", "/size?n=100", 0, 1},
+	{"GET", "/size?n=20000&chunked=1", 10, 1},
+	{"GET", "/size?n=1000000", 10, 3}, // too much to drain.
+	{"HEAD", "/size?n=100", 0, 1},
+	{"GET", "/close", -1, 3},
+}
+
+func TestConnReuse(t *testing.T) {
+	for _, tt := range connReuseTests {
+		l, err := net.ListenTCP("tcp4", localhost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cl := &countingListener{Listener: l}
+		go http.Serve(cl, reusemux())
+		c := Client{dialer: new(dialer), OnLeak: LeakPanic}
+		for i := 0; i < 3; i++ {
+			_, _, r, err := c.Do(tt.method, "http://"+l.Addr().String()+tt.path, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.read < 0 {
+				io.Copy(io.Discard, r)
+				continue
+			}
+			io.CopyN(io.Discard, r, tt.read)
+			if err := r.Close(); err != nil {
+				t.Errorf("%s %s: Close: %v", tt.method, tt.path, err)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("%s %s: second Close: %v", tt.method, tt.path, err)
+			}
+		}
+		if cl.count() != tt.conns {
+			t.Errorf("%s %s: expected %d connections, got %d", tt.method, tt.path, tt.conns, cl.count())
+		}
+		l.Close()
+	}
+}
+
+// TestConnReuseStale checks a request is sent again on a new connection if
+// the pooled connection was closed by the server while idle.
+func TestConnReuseStale(t *testing.T) {
+	l, err := net.ListenTCP("tcp4", localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// answer one request, then close the connection without warning.
+			br := bufio.NewReader(c)
+			if _, err := http.ReadRequest(br); err == nil {
+				io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nOK")
+			}
+			time.Sleep(10 * time.Millisecond)
+			c.Close()
+		}
+	}()
+	tracer := new(recordingTracer)
+	c := Client{dialer: new(dialer), Tracer: tracer}
+	for i := 0; i < 3; i++ {
+		_, _, r, err := c.Get("http://"+l.Addr().String()+"/", nil)
+		if err != nil {
+			t.Fatalf("Get %d: %v", i, err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(b) != "OK" {
+			t.Fatalf("Get %d: expected OK, got %q, %v", i, b, err)
+		}
+		time.Sleep(50 * time.Millisecond) // let the server close the connection.
+	}
+	if s := c.Stats()[l.Addr().String()]; s.Dialed != 3 || s.Evicted != 2 {
+		t.Errorf("Stats: expected 3 dialed and 2 evicted, got %+v", s)
+	}
+	for i, span := range tracer.spans {
+		if expected := map[bool]int{false: 0, true: 1}[i > 0]; span.Retries != expected {
+			t.Errorf("Get %d: expected %d retries, got %d", i, expected, span.Retries)
+		}
+	}
+}
+
+var connRetryTests = []struct {
+	method  string
+	headers map[string][]string
+	// second is written by the server in answer to the second request on a
+	// connection, which is then closed.
+	second  string
+	retried bool
+}{
+	{"GET", nil, "", true},
+	{"DELETE", nil, "", false},
+	{"POST", nil, "", false},
+	{"DELETE", map[string][]string{"Idempotency-Key": {"1"}}, "", true},
+	// the server may have acted on a request it began to answer.
+	{"GET", nil, "HTTP/1.1 200 OK\r\n", false},
+	// a request which cannot be written does not show the connection to be stale.
+	{"GET", map[string][]string{"Bad Name": {"x"}}, "", false},
+}
+
+// a request which fails on a reused connection is sent again only if it is
+// idempotent and the connection was closed before any of the response was read.
+func TestConnRetry(t *testing.T) {
+	for _, tt := range connRetryTests {
+		l, err := net.ListenTCP("tcp4", localhost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func(second string) {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				br := bufio.NewReader(c)
+				if _, err := http.ReadRequest(br); err == nil {
+					io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nOK")
+				}
+				if _, err := http.ReadRequest(br); err == nil {
+					io.WriteString(c, second)
+				}
+				c.Close()
+			}
+		}(tt.second)
+		tracer := new(recordingTracer)
+		c := Client{dialer: new(dialer), Tracer: tracer}
+		url := "http://" + l.Addr().String() + "/"
+		_, _, r, err := c.Do(tt.method, url, nil, nil)
+		if err != nil {
+			t.Fatalf("%s %v: %v", tt.method, tt.headers, err)
+		}
+		io.ReadAll(r)
+		r.Close()
+		_, _, r, err = c.Do(tt.method, url, tt.headers, nil)
+		if err == nil {
+			io.ReadAll(r)
+			r.Close()
+		}
+		if (err == nil) != tt.retried {
+			t.Errorf("%s %v: expected retried %v, got error %v", tt.method, tt.headers, tt.retried, err)
+		}
+		evicted := map[bool]int64{false: 0, true: 1}[tt.retried]
+		if s := c.Stats()[l.Addr().String()]; s.Evicted != evicted {
+			t.Errorf("%s %v: expected %d evicted, got %+v", tt.method, tt.headers, evicted, s)
+		}
+		retries := map[bool]int{false: 0, true: 1}[tt.retried]
+		if len(tracer.spans) != 2 || tracer.spans[1].Retries != retries {
+			t.Errorf("%s %v: expected %d retries, got %+v", tt.method, tt.headers, retries, tracer.spans)
+		}
+	}
+}
+
+var interimTests = []struct {
+	// first is written by the server in answer to the first request on a
+	// connection, and "HTTP/1.1 200 OK" with body "second" to the next.
+	first    string
+	expected []string // the status and body of each of two requests
+	stats    PoolStats
+}{
+	{
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfirst",
+		[]string{"200 OK first", "200 OK second"},
+		PoolStats{Idle: 1, Dialed: 1, Reused: 1},
+	},
+	{
+		"HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n",
+		[]string{"101 Switching Protocols ", "101 Switching Protocols "},
+		PoolStats{Dialed: 2, Closed: 2},
+	},
+}
+
+// a 1xx response other than 101 is followed by the final response, and a
+// connection switched to another protocol is not reused.
+func TestConnInterim(t *testing.T) {
+	for _, tt := range interimTests {
+		l, err := net.ListenTCP("tcp4", localhost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func(first string) {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer c.Close()
+					br := bufio.NewReader(c)
+					for _, resp := range []string{first, "HTTP/1.1 200 OK\r\nContent-Length: 6\r\n\r\nsecond"} {
+						if _, err := http.ReadRequest(br); err != nil {
+							return
+						}
+						io.WriteString(c, resp)
+					}
+				}()
+			}
+		}(tt.first)
+		c := Client{dialer: new(dialer)}
+		url := "http://" + l.Addr().String() + "/"
+		for i, expected := range tt.expected {
+			status, _, r, err := c.Get(url, nil)
+			if err != nil {
+				t.Fatalf("%q: request %d: %v", tt.first, i, err)
+			}
+			b, err := io.ReadAll(r)
+			r.Close()
+			if actual := status.String() + " " + string(b); err != nil || actual != expected {
+				t.Errorf("%q: request %d: expected %q, got %q, %v", tt.first, i, expected, actual, err)
+			}
+		}
+		if s := c.Stats()[l.Addr().String()]; s != tt.stats {
+			t.Errorf("%q: expected %+v, got %+v", tt.first, tt.stats, s)
+		}
+	}
+}
+
+var poolStatsTests = []struct {
+	path     string
+	expected PoolStats
+	events   string
+}{
+	{"/size?n=100", PoolStats{Idle: 1, Dialed: 1, Reused: 2}, "dial release reuse release reuse release"},
+	{"/close", PoolStats{Dialed: 3, Closed: 3}, "dial close dial close dial close"},
+}
+
+func TestPoolStats(t *testing.T) {
+	for _, tt := range poolStatsTests {
+		s := newServer(t, reusemux())
+		c := &Client{dialer: new(dialer)}
+		var mu sync.Mutex
+		var events []string
+		hook := func(event string) func(string, net.Conn) {
+			return func(pool string, _ net.Conn) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event)
+			}
+		}
+		c.SetPoolHooks(PoolHooks{
+			OnDial:    hook("dial"),
+			OnReuse:   hook("reuse"),
+			OnRelease: hook("release"),
+			OnClose:   hook("close"),
+			OnEvict:   hook("evict"),
+		})
+		for i := 0; i < 3; i++ {
+			_, _, r, err := c.Get(s.Root()+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, r)
+			r.Close()
+		}
+		stats := c.Stats()
+		if actual := stats[strings.TrimPrefix(s.Root(), "http://")]; actual != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.path, tt.expected, stats)
+		}
+		mu.Lock()
+		if actual := strings.Join(events, " "); actual != tt.events {
+			t.Errorf("%s: expected events %q, got %q", tt.path, tt.events, actual)
+		}
+		mu.Unlock()
+		s.Shutdown()
+	}
+}
+
+// a pooled connection records the transcript of the request using it, if any.
+func TestConnTranscript(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+	var b syncBuffer
+	d := new(dialer)
+	for _, transcript := range []*client.Transcript{{W: &b}, nil, {W: &b}} {
+		c := &Client{dialer: d, Transcript: transcript}
+		_, _, r, err := c.Get(s.Root()+"/200", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, r)
+		r.Close()
+	}
+	out := b.String()
+	if n := strings.Count(out, "=> Send header"); n != 2 {
+		t.Errorf("expected 2 requests transcribed, got %d:\n%s", n, out)
+	}
+	if !strings.Contains(out, "GET /200 HTTP/1.1\n") || !strings.Contains(out, "<= Recv data, 2 bytes\nOK\n") {
+		t.Errorf("expected the request and response in the transcript, got:\n%s", out)
+	}
+	if st := d.stats()[strings.TrimPrefix(s.Root(), "http://")]; st.Dialed != 1 {
+		t.Errorf("expected the connection to be reused, got %+v", st)
+	}
+}
@@ -0,0 +1,176 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Decoder returns a reader which decodes r, a body encoded with a content
+// coding, rfc 9110 s8.4.1. Close is called once the body has been read.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// decoders holds the registered content codings, in the order they are
+// advertised in Accept-Encoding.
+var decoders = struct {
+	sync.RWMutex
+	names []string
+	m     map[string]Decoder
+}{m: make(map[string]Decoder)}
+
+func init() {
+	RegisterDecoder("gzip", func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	})
+	RegisterDecoder("deflate", newDeflateReader)
+	RegisterDecoder("br", func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	})
+	RegisterDecoder("zstd", func(r io.Reader) (io.ReadCloser, error) {
+		// rfc 9659 limits the window used by zstd content coding to 8MB.
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(8<<20))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	})
+}
+
+// RegisterDecoder registers d as the Decoder for the content coding name,
+// replacing any Decoder already registered for it. Registered codings are
+// advertised in the Accept-Encoding header sent by a Client, in the order they
+// were first registered. gzip, deflate, br and zstd are registered by default.
+func RegisterDecoder(name string, d Decoder) {
+	name = strings.ToLower(name)
+	decoders.Lock()
+	defer decoders.Unlock()
+	if _, ok := decoders.m[name]; !ok {
+		decoders.names = append(decoders.names, name)
+	}
+	decoders.m[name] = d
+}
+
+// acceptEncoding returns the value of the Accept-Encoding header advertising
+// the registered content codings.
+func acceptEncoding() string {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	return strings.Join(decoders.names, ", ")
+}
+
+// contentCodings returns the Decoders for the codings listed in a
+// Content-Encoding header, in the order they must be applied to decode the
+// body. If any coding is not registered ok is false.
+func contentCodings(contentEncoding string) (ds []Decoder, ok bool) {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	for _, c := range strings.Split(contentEncoding, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || c == "identity" {
+			continue
+		}
+		d, ok := decoders.m[c]
+		if !ok {
+			return nil, false
+		}
+		// codings are listed in the order they were applied.
+		ds = append([]Decoder{d}, ds...)
+	}
+	return ds, true
+}
+
+// decodingReader decodes a body with a stack of Decoders. The decoders are
+// not created until the first Read, so creating one does not block on the
+// body, and an empty body is not an error.
+type decodingReader struct {
+	body     io.Reader
+	closer   io.Closer // closes body
+	decoders []Decoder
+	r        io.Reader
+	closers  []io.Closer // the decoders created
+	err      error
+}
+
+func (d *decodingReader) Read(buf []byte) (int, error) {
+	if d.r == nil && d.err == nil {
+		d.r = d.body
+		for _, dec := range d.decoders {
+			rc, err := dec(d.r)
+			if err != nil {
+				d.err = err
+				break
+			}
+			d.r = rc
+			d.closers = append(d.closers, rc)
+		}
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.r.Read(buf)
+}
+
+// Close closes the decoders, outermost first, then the body.
+func (d *decodingReader) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		err = firstErr(err, d.closers[i].Close())
+	}
+	d.closers = nil
+	return firstErr(d.closer.Close(), err)
+}
+
+// decodeBody wraps body, which is closed by closer, to decode the content
+// codings listed in headers, removing the Content-Encoding and Content-Length
+// headers, which no longer describe it. If a coding is not registered body is
+// returned undecoded, with the headers untouched.
+func decodeBody(headers map[string][]string, body io.Reader, closer io.Closer) (io.Reader, io.Closer) {
+	var ce []string
+	for k, v := range headers {
+		if strings.EqualFold(k, "Content-Encoding") {
+			ce = append(ce, v...)
+		}
+	}
+	if len(ce) == 0 {
+		return body, closer
+	}
+	ds, ok := contentCodings(strings.Join(ce, ","))
+	if !ok {
+		return body, closer
+	}
+	for k := range headers {
+		if strings.EqualFold(k, "Content-Encoding") || strings.EqualFold(k, "Content-Length") {
+			delete(headers, k)
+		}
+	}
+	if len(ds) == 0 {
+		return body, closer
+	}
+	d := &decodingReader{body: body, closer: closer, decoders: ds}
+	return d, d
+}
+
+// newDeflateReader decodes the deflate content coding, which should be zlib
+// wrapped, rfc 9110 s8.4.1.2, but is sent raw by some servers.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	h, err := br.Peek(2)
+	if err != nil {
+		if err == io.EOF && len(h) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("deflate: %w", err)
+	}
+	if h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
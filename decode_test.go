@@ -0,0 +1,180 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	stdhttp "net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var encoders = map[string]func(io.Writer) io.WriteCloser{
+	"gzip":     func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	"deflate":  func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+	"rawflate": func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw },
+	"br":       func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	"zstd":     func(w io.Writer) io.WriteCloser { zw, _ := zstd.NewWriter(w); return zw },
+	"compress": func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} },
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// encode applies the comma separated encoders in order.
+func encode(t *testing.T, codings string, data []byte) []byte {
+	for _, c := range strings.Split(codings, ",") {
+		var b bytes.Buffer
+		w := encoders[strings.TrimSpace(c)](&b)
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = b.Bytes()
+	}
+	return data
+}
+
+// encodingmux serves /encode?ce=codings, encoding the body with codings and
+// echoing the Accept-Encoding request header.
+func encodingmux(t *testing.T) *stdhttp.ServeMux {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/encode", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		ce := r.URL.Query().Get("ce")
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", strings.ReplaceAll(ce, "rawflate", "deflate"))
+		if ce == "" {
+			ce = "compress"
+		}
+		w.Write(encode(t, ce, []byte(a())))
+	})
+	mux.HandleFunc("/corrupt", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		io.WriteString(w, "this is not a gzip stream")
+	})
+	return mux
+}
+
+var decodeTests = []struct {
+	ce      string
+	headers map[string][]string
+	decoded bool
+}{
+	{"", nil, true},
+	{"gzip", nil, true},
+	{"deflate", nil, true},
+	{"rawflate", nil, true},
+	{"br", nil, true},
+	{"zstd", nil, true},
+	{"gzip, br", nil, true},
+	{"deflate,zstd", nil, true},
+	{"compress", nil, false},
+	{"gzip, compress", nil, false},
+	{"br", map[string][]string{"accept-encoding": {"br"}}, true},
+	{"gzip", map[string][]string{"Accept-Encoding": {"identity"}}, false},
+}
+
+func TestClientDecode(t *testing.T) {
+	s := newServer(t, encodingmux(t))
+	defer s.Shutdown()
+	for _, tt := range decodeTests {
+		var c Client
+		_, headers, r, err := c.Get(s.Root()+"/encode?ce="+url.QueryEscape(tt.ce), tt.headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("Get(%q): %v", tt.ce, err)
+			continue
+		}
+		expected := "gzip, deflate, br, zstd"
+		if tt.headers != nil {
+			expected = strings.Join(tt.headers["Accept-Encoding"], "") + strings.Join(tt.headers["accept-encoding"], "")
+		}
+		if ae := headerValue(headers, "X-Accept-Encoding"); ae != expected {
+			t.Errorf("Get(%q): Accept-Encoding expected %q, got %q", tt.ce, expected, ae)
+		}
+		expectedBody := []byte(a())
+		if !tt.decoded {
+			expectedBody = encode(t, tt.ce, expectedBody)
+		}
+		_, hasCE := headers["Content-Encoding"]
+		if hasCE == tt.decoded && tt.ce != "" || !bytes.Equal(body, expectedBody) {
+			t.Errorf("Get(%q): expected decoded %v, got headers %v", tt.ce, tt.decoded, headers)
+		}
+	}
+}
+
+func TestClientDisableDecompression(t *testing.T) {
+	s := newServer(t, encodingmux(t))
+	defer s.Shutdown()
+	c := Client{DisableDecompression: true}
+	_, headers, r, err := c.Get(s.Root()+"/encode?ce=gzip", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, _ := io.ReadAll(r)
+	if ae := headerValue(headers, "X-Accept-Encoding"); ae != "" || headerValue(headers, "Content-Encoding") != "gzip" || !bytes.Equal(body, encode(t, "gzip", []byte(a()))) {
+		t.Errorf("Get: expected gzip body without Accept-Encoding, got %q %v", ae, headers)
+	}
+}
+
+func TestClientDecodeErrors(t *testing.T) {
+	s := newServer(t, encodingmux(t))
+	defer s.Shutdown()
+	var c Client
+	_, _, r, err := c.Get(s.Root()+"/corrupt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); err != gzip.ErrHeader {
+		t.Errorf("ReadAll: expected %v, got %v", gzip.ErrHeader, err)
+	}
+
+	// a HEAD response has no body to decode.
+	status, headers, r, err := c.Do("HEAD", s.Root()+"/encode?ce=gzip", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if status.Code != 200 || headerValue(headers, "Content-Encoding") != "gzip" {
+		t.Errorf("HEAD: expected 200 with Content-Encoding, got %v %v", status, headers)
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	defer func() {
+		decoders.Lock()
+		delete(decoders.m, "compress")
+		decoders.names = decoders.names[:len(decoders.names)-1]
+		decoders.Unlock()
+	}()
+	RegisterDecoder("Compress", func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil })
+	if ae := acceptEncoding(); ae != "gzip, deflate, br, zstd, compress" {
+		t.Errorf("acceptEncoding: unexpected %q", ae)
+	}
+	s := newServer(t, encodingmux(t))
+	defer s.Shutdown()
+	var c Client
+	_, headers, r, err := c.Get(s.Root()+"/encode?ce=compress", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if body, _ := io.ReadAll(r); string(body) != a() || headerValue(headers, "Content-Encoding") != "" {
+		t.Errorf("Get: expected decoded body, got %v", headers)
+	}
+}
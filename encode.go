@@ -0,0 +1,126 @@
+package http
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// requestEncoders holds the content codings which may be used to compress request bodies.
+var requestEncoders = map[string]func(io.Writer) (io.WriteCloser, error){
+	"gzip": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	"zstd": func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(8<<20))
+	},
+}
+
+// WithRequestEncoding returns a copy of c which compresses request bodies
+// with the content coding, or, if coding is "", does not. The copy shares the
+// connections of c, so may be used for a single request.
+func (c *Client) WithRequestEncoding(coding string) *Client {
+	cc := *c
+	cc.RequestEncoding = coding
+	return &cc
+}
+
+// encodeBody returns a reader which compresses body with coding as it is read.
+// The reader must be closed to stop the goroutine compressing body.
+func encodeBody(coding string, body io.Reader) (io.ReadCloser, error) {
+	enc, ok := requestEncoders[coding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported request encoding %q", coding)
+	}
+	pr, pw := io.Pipe()
+	w, err := enc(pw)
+	if err != nil {
+		return nil, err
+	}
+	e := &encodingReader{pr, make(chan struct{})}
+	go func() {
+		defer close(e.done)
+		_, err := io.Copy(w, body)
+		pw.CloseWithError(firstErr(err, w.Close()))
+	}()
+	return e, nil
+}
+
+// encodingReader reads a body compressed by another goroutine.
+type encodingReader struct {
+	*io.PipeReader
+	done chan struct{} // closed once the goroutine has finished with the body
+}
+
+// Close stops the compression, waiting until the body is no longer being read.
+func (e *encodingReader) Close() error {
+	e.PipeReader.Close()
+	<-e.done
+	return nil
+}
+
+// requestEncoding holds the state of a request body compressed by Client.Do.
+type requestEncoding struct {
+	coding string
+	length int64 // the length of the body before it was compressed, or zero
+
+	// rewind, if non nil, returns the body to where it was before it was
+	// compressed, so the request may be sent again uncompressed.
+	rewind func() error
+}
+
+// encodeRequest compresses body with the RequestEncoding of c, adding a
+// Content-Encoding header to headers. length is the length of body, if known.
+// If the request need not be compressed, it returns body and a nil
+// *requestEncoding.
+func (c *Client) encodeRequest(headers map[string][]string, body io.Reader, length int64) (io.ReadCloser, *requestEncoding, error) {
+	if body == nil || c.RequestEncoding == "" {
+		return nil, nil, nil
+	}
+	if _, ok := header(headers, "Content-Encoding"); ok {
+		return nil, nil, nil // already encoded by the caller.
+	}
+	e := &requestEncoding{coding: c.RequestEncoding, length: length}
+	if s, ok := body.(io.Seeker); ok && c.RequestEncodingFallback {
+		if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+			e.rewind = func() error {
+				_, err := s.Seek(off, io.SeekStart)
+				return err
+			}
+		}
+	}
+	rc, err := encodeBody(c.RequestEncoding, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers["Content-Encoding"] = []string{c.RequestEncoding}
+	return rc, e, nil
+}
+
+// restore removes the Content-Encoding added to headers, and restores any
+// Content-Length, so the request may be sent again.
+func (e *requestEncoding) restore(headers map[string][]string) {
+	delete(headers, "Content-Encoding")
+	if e.length > 0 {
+		headers["Content-Length"] = []string{strconv.FormatInt(e.length, 10)}
+	}
+}
+
+// refused reports whether a response with status and headers refused the
+// encoding, rfc 7694 s3, and the request can be sent again uncompressed.
+func (e *requestEncoding) refused(status int, headers map[string][]string) bool {
+	if e == nil || e.rewind == nil || status != 415 {
+		return false
+	}
+	ae, _ := header(headers, "Accept-Encoding")
+	for _, c := range strings.Split(ae, ",") {
+		if c, _, _ := strings.Cut(c, ";"); strings.EqualFold(strings.TrimSpace(c), e.coding) {
+			return false // the coding is accepted, something else is wrong.
+		}
+	}
+	return true
+}
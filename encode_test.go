@@ -0,0 +1,97 @@
+package http
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// encodingServer decodes request bodies sent to /upload, responding with
+// their framing and contents. /plain refuses encoded bodies with a 415.
+func encodingServer() *stdhttp.ServeMux {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/upload", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		var body io.Reader = r.Body
+		switch ce := r.Header.Get("Content-Encoding"); ce {
+		case "gzip":
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				stdhttp.Error(w, err.Error(), stdhttp.StatusBadRequest)
+				return
+			}
+			body = zr
+		case "zstd":
+			zr, err := zstd.NewReader(r.Body)
+			if err != nil {
+				stdhttp.Error(w, err.Error(), stdhttp.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			body = zr
+		}
+		b, err := io.ReadAll(body)
+		if err != nil {
+			stdhttp.Error(w, err.Error(), stdhttp.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%s %d %v %s", r.Header.Get("Content-Encoding"), r.ContentLength, r.TransferEncoding, b)
+	})
+	mux.HandleFunc("/plain", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if ce := r.Header.Get("Content-Encoding"); ce != "" {
+			w.Header().Set("Accept-Encoding", r.URL.Query().Get("accept"))
+			stdhttp.Error(w, "unsupported encoding "+ce, stdhttp.StatusUnsupportedMediaType)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%d %s", r.ContentLength, b)
+	})
+	return mux
+}
+
+var requestEncodingTests = []struct {
+	Client
+	path     string
+	headers  map[string][]string
+	body     func() io.Reader
+	expected string
+}{
+	{Client{RequestEncoding: "gzip"}, "/upload", nil, func() io.Reader { return strings.NewReader("telemetry") }, "gzip -1 [chunked] telemetry"},
+	{Client{RequestEncoding: "zstd"}, "/upload", map[string][]string{"Content-Length": {"9"}}, func() io.Reader { return strings.NewReader("telemetry") }, "zstd -1 [chunked] telemetry"},
+	{Client{}, "/upload", nil, func() io.Reader { return strings.NewReader("telemetry") }, " 9 [] telemetry"},
+	// bodies already encoded by the caller are sent as given.
+	{Client{RequestEncoding: "gzip"}, "/upload", map[string][]string{"Content-Encoding": {"identity"}}, func() io.Reader { return strings.NewReader("telemetry") }, "identity 9 [] telemetry"},
+	{Client{RequestEncoding: "gzip", RequestEncodingFallback: true}, "/plain", nil, func() io.Reader { return strings.NewReader("telemetry") }, "9 telemetry"},
+	{Client{RequestEncoding: "gzip", RequestEncodingFallback: true}, "/plain?accept=gzip", nil, func() io.Reader { return strings.NewReader("telemetry") }, "unsupported encoding gzip\n"},
+	{Client{RequestEncoding: "gzip"}, "/plain", nil, func() io.Reader { return strings.NewReader("telemetry") }, "unsupported encoding gzip\n"},
+	// the body cannot be rewound.
+	{Client{RequestEncoding: "gzip", RequestEncodingFallback: true}, "/plain", nil, func() io.Reader { return io.MultiReader(strings.NewReader("telemetry")) }, "unsupported encoding gzip\n"},
+}
+
+func TestClientRequestEncoding(t *testing.T) {
+	s := newServer(t, encodingServer())
+	defer s.Shutdown()
+	for _, tt := range requestEncodingTests {
+		_, encoded := tt.headers["Content-Encoding"]
+		_, _, r, err := tt.Client.Post(s.Root()+tt.path, tt.headers, tt.body())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(b) != tt.expected {
+			t.Errorf("Post(%q, %q): expected %q, got %q, %v", tt.RequestEncoding, tt.path, tt.expected, b, err)
+		}
+		if _, ok := tt.headers["Content-Encoding"]; ok != encoded {
+			t.Errorf("Post(%q, %q): Content-Encoding left in headers %v", tt.RequestEncoding, tt.path, tt.headers)
+		}
+	}
+
+	if _, _, _, err := new(Client).WithRequestEncoding("br").Post(s.Root()+"/upload", nil, strings.NewReader("x")); err == nil {
+		t.Error("Post: expected error for unsupported request encoding")
+	}
+}
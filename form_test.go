@@ -0,0 +1,53 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"testing"
+
+	"github.com/gorilla/http/client"
+)
+
+func formmux() *stdhttp.ServeMux {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/form", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if err := r.ParseForm(); err != nil {
+			stdhttp.Error(w, err.Error(), stdhttp.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("name") == "" {
+			stdhttp.Error(w, "name required", stdhttp.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%s %q %q %q", r.URL.RawQuery, r.URL.Query()["q"], r.PostForm["name"], r.PostForm.Get("note"))
+	})
+	return mux
+}
+
+func TestPostForm(t *testing.T) {
+	s := newServer(t, formmux())
+	defer s.Shutdown()
+
+	var q, form client.Values
+	q.Add("q", "a b")
+	q.Add("q", "c&d")
+	form.Add("name", "gorilla")
+	form.Add("name", "mux")
+	form.Add("note", "100% = all")
+	var c Client
+	status, _, r, err := c.PostForm(s.Root()+"/form?"+q.Encode(), nil, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, _ := io.ReadAll(r)
+	expected := `q=a+b&q=c%26d ["a b" "c&d"] ["gorilla" "mux"] "100% = all"`
+	if status.Code != 200 || string(b) != expected {
+		t.Errorf("PostForm: expected %q, got %v %q", expected, status, b)
+	}
+
+	if err := PostForm(s.Root()+"/form", nil); err == nil || err.Error() != "400 Bad Request" {
+		t.Errorf("PostForm: expected 400 Bad Request, got %v", err)
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/gorilla/http
 
 go 1.20
+
+require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/klauspost/compress v1.17.4
+)
@@ -13,6 +13,8 @@ package http
 
 import (
 	"io"
+
+	"github.com/gorilla/http/client"
 )
 
 // DefaultClient is the default http Client used by this package.
@@ -24,32 +26,55 @@ var DefaultClient = Client{
 	FollowRedirects: true,
 }
 
+// defaultClient returns the DefaultClient, applying DefaultLimits if it has no Limits.
+func defaultClient() *Client {
+	if DefaultClient.Limits == (Limits{}) {
+		return DefaultClient.WithLimits(DefaultLimits)
+	}
+	return &DefaultClient
+}
+
 // Get issues a GET request using the DefaultClient and writes the result to
 // to w if successful. If the status code of the response is not a success (see
 // Success.IsSuccess()) no data will be written and the status code will be
-// returned as an error.
+// returned as a *StatusError.
 func Get(w io.Writer, url string) (int64, error) {
-	status, _, r, err := DefaultClient.Get(url, nil)
+	status, headers, r, err := defaultClient().Get(url, nil)
 	if err != nil {
 		return 0, err
 	}
 	defer r.Close()
 	if !status.IsSuccess() {
-		return 0, &StatusError{status}
+		return 0, NewStatusError(status, headers, r)
 	}
 	return io.Copy(w, r)
 }
 
 // Post issues a POST request using the DefaultClient using r as the body.
-// If the status code was not a success code, it will be returned as an error.
+// If the status code was not a success code, it will be returned as a *StatusError.
 func Post(url string, r io.Reader) error {
-	status, _, rc, err := DefaultClient.Post(url, nil, r)
+	status, headers, rc, err := defaultClient().Post(url, nil, r)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if !status.IsSuccess() {
+		return NewStatusError(status, headers, rc)
+	}
+	return nil
+}
+
+// PostForm issues a POST request using the DefaultClient with form encoded as
+// the body. If the status code was not a success code, it will be returned as
+// a *StatusError.
+func PostForm(url string, form client.Values) error {
+	status, headers, rc, err := defaultClient().PostForm(url, nil, form)
 	if err != nil {
 		return err
 	}
 	defer rc.Close()
 	if !status.IsSuccess() {
-		return &StatusError{status}
+		return NewStatusError(status, headers, rc)
 	}
 	return nil
 }
@@ -73,7 +73,8 @@ var getTests = []struct {
 	{"/200", "OK", nil},
 	{"/%2f", "", errors.New("404 Not Found")}, // issue #1
 	{"/404", "", errors.New("404 Not Found")},
-	{"/a", a(), nil}, // triggers chunked encoding
+	{"/with%20space", "", errors.New("404 Not Found")}, // escaped paths are sent as is
+	{"/a", a(), nil},                                   // triggers chunked encoding
 }
 
 func TestGet(t *testing.T) {
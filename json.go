@@ -0,0 +1,86 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/gorilla/http/client"
+)
+
+// GetJSON issues a GET request using the DefaultClient and decodes the JSON
+// response into a T. If the status code was not a success code, it will be
+// returned as a *StatusError.
+func GetJSON[T any](url string) (T, error) {
+	var v T
+	err := defaultClient().GetJSON(url, nil, &v)
+	return v, err
+}
+
+// PostJSON issues a POST request using the DefaultClient with req encoded as
+// JSON as the body, and decodes the JSON response into a Resp. If the status
+// code was not a success code, it will be returned as a *StatusError.
+func PostJSON[Req, Resp any](url string, req Req) (Resp, error) {
+	var v Resp
+	err := defaultClient().PostJSON(url, nil, req, &v)
+	return v, err
+}
+
+// GetJSON sends a GET request accepting JSON and decodes the response into v.
+// If the status code was not a success code, it will be returned as a
+// *StatusError carrying the decoded response body.
+func (c *Client) GetJSON(url string, headers map[string][]string, v interface{}) error {
+	return c.doJSON("GET", url, headers, nil, v)
+}
+
+// PostJSON sends a POST request with req encoded as JSON as the body, and
+// decodes the response into resp, which may be nil to discard it. If the
+// status code was not a success code, it will be returned as a *StatusError
+// carrying the decoded response body.
+func (c *Client) PostJSON(url string, headers map[string][]string, req, resp interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return c.doJSON("POST", url, headers, b, resp)
+}
+
+// doJSON sends a request with body, if non nil, as JSON and decodes a
+// successful response into v.
+func (c *Client) doJSON(method, url string, headers map[string][]string, body []byte, v interface{}) error {
+	h := make(map[string][]string, len(headers)+2)
+	for k, v := range headers {
+		h[k] = v
+	}
+	setDefault(h, "Accept", "application/json")
+	var r io.Reader
+	if body != nil {
+		setDefault(h, "Content-Type", "application/json")
+		r = bytes.NewReader(body)
+	}
+	status, rheaders, rc, err := c.Do(method, url, h, r)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if !status.IsSuccess() {
+		e := NewStatusError(status, rheaders, rc)
+		json.Unmarshal(e.Body, &e.JSON) // nolint:errcheck
+		return e
+	}
+	if v == nil || status.Code == client.SUCCESS_NO_CONTENT {
+		return nil
+	}
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// setDefault sets the header key to value, unless headers already holds it.
+func setDefault(headers map[string][]string, key, value string) {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			return
+		}
+	}
+	headers[key] = []string{value}
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	stdhttp "net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/http/client"
+)
+
+type greeting struct {
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func jsonmux() *stdhttp.ServeMux {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/hello", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			stdhttp.Error(w, "not acceptable", stdhttp.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(greeting{Message: "hello"})
+		case "POST":
+			var g greeting
+			if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&g) != nil || g.Name == "" {
+				w.WriteHeader(stdhttp.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "name required"})
+				return
+			}
+			json.NewEncoder(w).Encode(greeting{Message: "hello " + g.Name})
+		}
+	})
+	mux.HandleFunc("/empty", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.WriteHeader(stdhttp.StatusNoContent)
+	})
+	return mux
+}
+
+func TestGetJSON(t *testing.T) {
+	s := newServer(t, jsonmux())
+	defer s.Shutdown()
+
+	g, err := GetJSON[greeting](s.Root() + "/hello")
+	if err != nil || g.Message != "hello" {
+		t.Errorf("GetJSON: expected hello, got %v, %v", g, err)
+	}
+	if _, err := GetJSON[greeting](s.Root() + "/404"); err == nil || err.Error() != "404 Not Found" {
+		t.Errorf("GetJSON: expected 404 Not Found, got %v", err)
+	}
+}
+
+var postJSONTests = []struct {
+	path     string
+	req      greeting
+	expected greeting
+	err      error
+}{
+	{"/hello", greeting{Name: "gorilla"}, greeting{Message: "hello gorilla"}, nil},
+	{"/hello", greeting{}, greeting{}, &StatusError{
+		Status:  client.Status{Code: 400, Reason: "Bad Request"},
+		Headers: map[string][]string{"Content-Type": {"application/json"}, "Content-Length": {"26"}},
+		Body:    []byte(`{"error":"name required"}` + "\n"),
+		JSON:    map[string]interface{}{"error": "name required"},
+	}},
+	{"/empty", greeting{Name: "gorilla"}, greeting{}, nil},
+}
+
+func TestPostJSON(t *testing.T) {
+	s := newServer(t, jsonmux())
+	defer s.Shutdown()
+	for _, tt := range postJSONTests {
+		var c Client
+		headers := map[string][]string{"X-Request-Id": {"1"}}
+		var actual greeting
+		err := c.PostJSON(s.Root()+tt.path, headers, tt.req, &actual)
+		if serr, ok := err.(*StatusError); ok {
+			delete(serr.Headers, "Date")
+		}
+		if actual != tt.expected || !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("PostJSON(%q, %v): expected %v, %v, got %v, %v", tt.path, tt.req, tt.expected, tt.err, actual, err)
+		}
+		if len(headers) != 1 {
+			t.Errorf("PostJSON(%q, %v): headers modified: %v", tt.path, tt.req, headers)
+		}
+	}
+
+	// the package level helper, with an error.
+	_, err := PostJSON[greeting, greeting](s.Root()+"/hello", greeting{})
+	var serr *StatusError
+	if !errors.As(err, &serr) || serr.Code != 400 || serr.JSON == nil {
+		t.Errorf("PostJSON: expected 400 with body, got %v", err)
+	}
+}
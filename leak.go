@@ -0,0 +1,110 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// LeakAction is what a Client does when it finds a response body was not
+// closed before it was garbage collected.
+type LeakAction int
+
+const (
+	// LeakLog logs the leak with the call site of the request.
+	LeakLog LeakAction = iota
+
+	// LeakPanic panics with the call site of the request.
+	LeakPanic
+
+	// LeakCount only counts the leak, see Leaks.
+	LeakCount
+
+	// LeakIgnore disables leak detection.
+	LeakIgnore
+)
+
+// leaks counts the response bodies found leaked.
+var leaks int64
+
+// Leaks returns the number of response bodies found to have been garbage
+// collected without being closed. As leaks are found by the garbage
+// collector they may not be counted for some time.
+func Leaks() int64 { return atomic.LoadInt64(&leaks) }
+
+// LeakError describes a response body which was not closed.
+type LeakError struct {
+	Method, URL string
+
+	// Caller is the call site of the request, as file:line.
+	Caller string
+}
+
+func (e *LeakError) Error() string {
+	return fmt.Sprintf("response body of %s %s from %s was not closed", e.Method, e.URL, e.Caller)
+}
+
+// readCloser is the response body returned by Client.Do.
+type readCloser struct {
+	io.Reader
+	io.Closer
+	eof int32 // accessed atomically, set once Read has returned io.EOF
+}
+
+func (r *readCloser) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		atomic.StoreInt32(&r.eof, 1)
+	}
+	return n, err
+}
+
+// Close closes the body, disarming leak detection.
+func (r *readCloser) Close() error {
+	runtime.SetFinalizer(r, nil)
+	return r.Closer.Close()
+}
+
+// watch arranges for action to be taken if r is garbage collected without
+// being closed. A body read to EOF, whose connection has been released, is
+// closed but not reported.
+func watch(r *readCloser, action LeakAction, method, url string) {
+	if action == LeakIgnore {
+		return
+	}
+	// the call site is resolved only if the body leaks.
+	pcs := make([]uintptr, 16)
+	pcs = pcs[:runtime.Callers(3, pcs)]
+	runtime.SetFinalizer(r, func(r *readCloser) {
+		r.Closer.Close() // release the connection.
+		if atomic.LoadInt32(&r.eof) != 0 {
+			return
+		}
+		atomic.AddInt64(&leaks, 1)
+		err := &LeakError{Method: method, URL: url, Caller: caller(pcs)}
+		switch action {
+		case LeakPanic:
+			panic(err)
+		case LeakLog:
+			log.Print("gorilla/http: ", err)
+		}
+	})
+}
+
+// caller returns the file and line of the first of pcs outside this package,
+// other than its tests.
+func caller(pcs []uintptr) string {
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "github.com/gorilla/http.") || strings.HasSuffix(f.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// leak sends a request with c, dropping the response body.
+func leak(t *testing.T, c *Client, url string) {
+	_, _, r, err := c.Get(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r
+}
+
+// collect runs the garbage collector until done returns true.
+func collect(t *testing.T, done func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("leak not detected")
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLeakCount(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+
+	n := Leaks()
+	leak(t, &Client{OnLeak: LeakCount}, s.Root()+"/200")
+	collect(t, func() bool { return Leaks() > n })
+}
+
+func TestLeakLog(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+
+	var b syncBuffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&b)
+
+	// a closed body is not a leak.
+	_, _, r, err := new(Client).Get(s.Root()+"/200?closed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	// nor is a body read to EOF, as its connection has been released.
+	_, _, r, err = new(Client).Get(s.Root()+"/200?eof", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(r)
+
+	leak(t, new(Client), s.Root()+"/200?leaked")
+	expected := "response body of GET " + s.Root() + "/200?leaked from "
+	collect(t, func() bool { return strings.Contains(b.String(), expected) })
+	if msg := b.String(); !strings.Contains(msg, "leak_test.go:") || strings.Contains(msg, "?closed") || strings.Contains(msg, "?eof") {
+		t.Errorf("log: expected only the leak with its call site, got %q", msg)
+	}
+}
+
+func TestLeakCaller(t *testing.T) {
+	pcs := make([]uintptr, 16)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	if c := caller(pcs); !strings.Contains(c, "leak_test.go:") {
+		t.Errorf("caller: expected leak_test.go, got %q", c)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for use by the finalizer goroutine.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
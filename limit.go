@@ -0,0 +1,121 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// minRatioCheck is the decoded size below which MaxCompressionRatio is not
+// enforced, as small bodies, for example of repeated characters, may
+// legitimately compress very well.
+const minRatioCheck = 1 << 20
+
+// Limits bounds the size of response bodies. A zero value means no limit.
+type Limits struct {
+	// MaxBodySize is the most bytes of a response body read from the wire.
+	MaxBodySize int64
+
+	// MaxDecodedSize is the most bytes of a response body returned once
+	// content codings have been decoded.
+	MaxDecodedSize int64
+
+	// MaxCompressionRatio is the greatest ratio of decoded to wire bytes
+	// allowed once more than 1MB has been decoded.
+	MaxCompressionRatio float64
+}
+
+// DefaultLimits are used by the package level functions if the DefaultClient
+// has no Limits.
+var DefaultLimits = Limits{
+	MaxBodySize:         1 << 30,
+	MaxDecodedSize:      1 << 30,
+	MaxCompressionRatio: 500,
+}
+
+// LimitError is returned when reading a response body which exceeds one of
+// its Limits, rather than the error which would otherwise end the body. The
+// body read so far is truncated at the limit.
+type LimitError struct {
+	// Limit names the limit exceeded, one of "MaxBodySize", "MaxDecodedSize"
+	// or "MaxCompressionRatio".
+	Limit string
+
+	// Value is the value of the limit.
+	Value float64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("response body exceeds %s of %v", e.Limit, e.Value)
+}
+
+// WithLimits returns a copy of c which applies l to the responses it reads. The
+// copy shares the connections of c, so may be used for a single request.
+func (c *Client) WithLimits(l Limits) *Client {
+	cc := *c
+	cc.Limits = l
+	return &cc
+}
+
+// limitBody applies the limits of c to a response body with the given
+// headers, decoding it first if decode is set.
+func (c *Client) limitBody(headers map[string][]string, body io.Reader, closer io.Closer, decode bool) (io.Reader, io.Closer) {
+	l := c.Limits
+	wire := &countingReader{r: body, limit: "MaxBodySize", max: l.MaxBodySize}
+	if cl, err := strconv.ParseInt(headerValue(headers, "Content-Length"), 10, 64); err == nil && l.MaxBodySize > 0 && cl > l.MaxBodySize {
+		// fail early, there is no need to read it.
+		wire.err = &LimitError{"MaxBodySize", float64(l.MaxBodySize)}
+	}
+	body = wire
+	decoded := false
+	if decode {
+		var r io.Reader
+		r, closer = decodeBody(headers, body, closer)
+		decoded = r != body
+		body = r
+	}
+	if l.MaxDecodedSize > 0 || decoded && l.MaxCompressionRatio > 0 {
+		d := &countingReader{r: body, limit: "MaxDecodedSize", max: l.MaxDecodedSize}
+		if decoded {
+			d.wire, d.ratio = wire, l.MaxCompressionRatio
+		}
+		body = d
+	}
+	return body, closer
+}
+
+// countingReader counts the bytes read through it, returning a *LimitError
+// once there are more than max, or more than ratio times the bytes read
+// through wire.
+type countingReader struct {
+	r     io.Reader
+	n     int64
+	limit string // the name of the limit enforced by max
+	max   int64
+	wire  *countingReader
+	ratio float64
+	err   error
+}
+
+func (c *countingReader) Read(buf []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.max > 0 && int64(len(buf)) > c.max-c.n+1 {
+		// read one byte more than allowed to tell whether there is more.
+		buf = buf[:c.max-c.n+1]
+	}
+	n, err := c.r.Read(buf)
+	c.n += int64(n)
+	switch {
+	case c.max > 0 && c.n > c.max:
+		n -= int(c.n - c.max)
+		c.n = c.max
+		c.err = &LimitError{c.limit, float64(c.max)}
+		return n, c.err
+	case c.ratio > 0 && c.n > minRatioCheck && float64(c.n) > c.ratio*float64(c.wire.n):
+		c.err = &LimitError{"MaxCompressionRatio", c.ratio}
+		return n, c.err
+	}
+	return n, err
+}
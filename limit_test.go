@@ -0,0 +1,104 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	stdhttp "net/http"
+	"strconv"
+	"testing"
+)
+
+// bomb returns n zero bytes, gzipped.
+func bomb(n int) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(make([]byte, n))
+	w.Close()
+	return b.Bytes()
+}
+
+func limitmux() *stdhttp.ServeMux {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/size", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(n))
+		} else {
+			w.(stdhttp.Flusher).Flush()
+		}
+		w.Write(bytes.Repeat([]byte{'x'}, n))
+	})
+	mux.HandleFunc("/bomb", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb(n))
+	})
+	return mux
+}
+
+var limitTests = []struct {
+	path   string
+	limits Limits
+	n      int    // bytes expected before the error
+	limit  string // the limit expected to be exceeded, if any
+}{
+	{"/size?n=1000", Limits{}, 1000, ""},
+	{"/size?n=1000", Limits{MaxBodySize: 1000}, 1000, ""},
+	{"/size?n=1000", Limits{MaxBodySize: 999}, 0, "MaxBodySize"},
+	{"/size?n=1000&chunked=1", Limits{MaxBodySize: 999}, 999, "MaxBodySize"},
+	{"/size?n=1000", Limits{MaxDecodedSize: 100}, 100, "MaxDecodedSize"},
+	{"/bomb?n=100000", Limits{MaxDecodedSize: 100000}, 100000, ""},
+	{"/bomb?n=100000", Limits{MaxDecodedSize: 99999}, 99999, "MaxDecodedSize"},
+	{"/bomb?n=100000", Limits{MaxBodySize: 50}, 0, "MaxBodySize"},
+	{"/bomb?n=100000", Limits{MaxCompressionRatio: 2}, 100000, ""}, // too small to check
+	{"/bomb?n=10000000", Limits{MaxCompressionRatio: 100}, minRatioCheck, "MaxCompressionRatio"},
+}
+
+func TestClientLimits(t *testing.T) {
+	s := newServer(t, limitmux())
+	defer s.Shutdown()
+	for _, tt := range limitTests {
+		c := new(Client).WithLimits(tt.limits)
+		_, _, r, err := c.Get(s.Root()+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, r)
+		r.Close()
+		var lerr *LimitError
+		switch {
+		case tt.limit == "" && err != nil:
+			t.Errorf("Get(%q, %+v): unexpected error %v", tt.path, tt.limits, err)
+		case tt.limit != "" && (!errors.As(err, &lerr) || lerr.Limit != tt.limit):
+			t.Errorf("Get(%q, %+v): expected %s exceeded, got %v", tt.path, tt.limits, tt.limit, err)
+		case tt.limit == "MaxCompressionRatio" && n < int64(tt.n):
+			t.Errorf("Get(%q, %+v): expected at least %d bytes, got %d", tt.path, tt.limits, tt.n, n)
+		case tt.limit != "MaxCompressionRatio" && n != int64(tt.n):
+			t.Errorf("Get(%q, %+v): expected %d bytes, got %d", tt.path, tt.limits, tt.n, n)
+		}
+	}
+}
+
+func TestGetDefaultLimits(t *testing.T) {
+	s := newServer(t, limitmux())
+	defer s.Shutdown()
+	defer func(l Limits) { DefaultLimits = l }(DefaultLimits)
+	DefaultLimits = Limits{MaxDecodedSize: 10}
+
+	var b bytes.Buffer
+	_, err := Get(&b, s.Root()+"/size?n=100")
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || b.Len() != 10 {
+		t.Errorf("Get: expected LimitError after 10 bytes, got %d, %v", b.Len(), err)
+	}
+
+	// limits set on the DefaultClient take precedence.
+	DefaultClient.Limits = Limits{MaxDecodedSize: 1000}
+	defer func() { DefaultClient.Limits = Limits{} }()
+	b.Reset()
+	if _, err := Get(&b, s.Root()+"/size?n=100"); err != nil || b.Len() != 100 {
+		t.Errorf("Get: expected 100 bytes, got %d, %v", b.Len(), err)
+	}
+}
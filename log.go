@@ -0,0 +1,83 @@
+package http
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gorilla/http/client"
+)
+
+// redacted replaces sensitive values in logs.
+const redacted = "REDACTED"
+
+// sensitiveHeaders are always redacted from logs, in addition to the
+// RedactHeaders of a Client.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+type loggerKey struct{}
+
+// logLevel is the level of an event logged by logEvent. The levels have the
+// values of slog.LevelDebug and slog.LevelWarn.
+type logLevel int
+
+const (
+	levelDebug logLevel = -4
+	levelWarn  logLevel = 4
+)
+
+// logHeaders logs headers, redacting the values of sensitive headers.
+type logHeaders struct {
+	headers map[string][]string
+	redact  []string
+}
+
+// values returns the headers, sorted by name, with sensitive values redacted.
+func (l logHeaders) values() (keys, values []string) {
+	for k := range l.headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := strings.Join(l.headers[k], ", ")
+		if l.sensitive(k) {
+			v = redacted
+		}
+		values = append(values, v)
+	}
+	return keys, values
+}
+
+func (l logHeaders) sensitive(key string) bool {
+	for _, names := range [][]string{sensitiveHeaders, l.redact} {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// logURL logs a url, redacting its password and the values of sensitive
+// query parameters.
+type logURL struct {
+	url    string
+	redact []string
+}
+
+// redactParams redacts the values of the parameters named in query.
+func redactParams(query string, names []string) string {
+	q, err := client.ParseValues(query)
+	if err != nil {
+		// the parameters cannot be told apart, so none are logged.
+		return redacted
+	}
+	for i := range q {
+		for _, name := range names {
+			if q[i].Name == name {
+				q[i].Value = redacted
+			}
+		}
+	}
+	return q.Encode()
+}
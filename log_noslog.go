@@ -0,0 +1,17 @@
+//go:build !go1.21
+
+package http
+
+import (
+	"context"
+	"io"
+
+	"github.com/gorilla/http/client"
+)
+
+// logEvent does nothing, as logging requires log/slog.
+func logEvent(ctx context.Context, level logLevel, msg string, args ...any) {}
+
+func (c *Client) doLog(ctx context.Context, method, url string, headers map[string][]string, body io.Reader) (client.Status, map[string][]string, io.ReadCloser, error) {
+	return c.doSpan(ctx, method, url, headers, body)
+}
@@ -0,0 +1,77 @@
+//go:build go1.21
+
+package http
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	stdurl "net/url"
+	"time"
+
+	"github.com/gorilla/http/client"
+)
+
+// SetLogger sets the Logger which logs the requests, responses, redirects,
+// retries and connections of c, or if l is nil stops logging. The values of
+// the Authorization, Proxy-Authorization, Cookie and Set-Cookie headers, and
+// of the RedactHeaders and RedactParams, are redacted.
+//
+// Logging requires Go 1.21 or later.
+func (c *Client) SetLogger(l *slog.Logger) {
+	if l == nil {
+		c.logger = nil
+		return
+	}
+	c.logger = l
+}
+
+// logEvent logs msg to the Logger of the Client making the request with ctx, if any.
+func logEvent(ctx context.Context, level logLevel, msg string, args ...any) {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		l.Log(ctx, slog.Level(level), msg, args...)
+	}
+}
+
+// doLog sends a request, logging it and its response if c has a Logger.
+func (c *Client) doLog(ctx context.Context, method, url string, headers map[string][]string, body io.Reader) (client.Status, map[string][]string, io.ReadCloser, error) {
+	l, ok := c.logger.(*slog.Logger)
+	if !ok {
+		return c.doSpan(ctx, method, url, headers, body)
+	}
+	ctx = context.WithValue(ctx, loggerKey{}, l)
+	start := time.Now()
+	u := logURL{url, c.RedactParams}
+	l.DebugContext(ctx, "http request", "method", method, "url", u, "headers", logHeaders{headers, c.RedactHeaders})
+	status, rheaders, r, err := c.doSpan(ctx, method, url, headers, body)
+	if err != nil {
+		l.ErrorContext(ctx, "http request failed", "method", method, "url", u, "duration", time.Since(start), "error", err)
+		return status, rheaders, r, err
+	}
+	args := []any{"method", method, "url", u, "status", status.Code, "duration", time.Since(start)}
+	if l.Enabled(ctx, slog.LevelDebug) {
+		args = append(args, "headers", logHeaders{rheaders, c.RedactHeaders})
+	}
+	l.InfoContext(ctx, "http response", args...)
+	return status, rheaders, r, err
+}
+
+func (l logHeaders) LogValue() slog.Value {
+	keys, values := l.values()
+	attrs := make([]slog.Attr, 0, len(keys))
+	for i, k := range keys {
+		attrs = append(attrs, slog.String(k, values[i]))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (l logURL) LogValue() slog.Value {
+	u, err := stdurl.Parse(l.url)
+	if err != nil {
+		return slog.StringValue(redacted) // it may hold anything.
+	}
+	if len(l.redact) > 0 && u.RawQuery != "" {
+		u.RawQuery = redactParams(u.RawQuery, l.redact)
+	}
+	return slog.StringValue(u.Redacted())
+}
@@ -0,0 +1,291 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	stdurl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request duration
+// histogram used by Metrics with no Buckets.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics counts the requests made by the Clients using it, and reports them,
+// with the statistics of their connection pools, in the Prometheus text
+// exposition format. The zero value is ready to use. A Metrics may be shared
+// by many Clients.
+type Metrics struct {
+	// Buckets are the upper bounds of the request duration histogram, in
+	// increasing order. If nil, DefaultBuckets are used. Buckets must not be
+	// changed once the Metrics is in use.
+	Buckets []float64
+
+	mu       sync.Mutex // protects following fields
+	requests map[requestLabels]*requestMetrics
+	inFlight map[[2]string]int64 // by host and method
+	dialers  map[*dialer]bool    // whose pools are reported
+}
+
+// requestLabels label the metrics of a request.
+type requestLabels struct {
+	host, method, status string
+}
+
+type requestMetrics struct {
+	count           int64
+	sent, received  int64
+	buckets         []int64 // counts of durations up to each bucket
+	durationSeconds float64
+}
+
+// start counts the start of a request made by c, returning the Span which
+// counts its end.
+func (m *Metrics) start(c *Client, method, url string) Span {
+	var host string
+	if u, err := stdurl.Parse(url); err == nil {
+		host = u.Host
+	}
+	key := [2]string{host, method}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.inFlight == nil {
+		m.inFlight = make(map[[2]string]int64)
+		m.requests = make(map[requestLabels]*requestMetrics)
+		m.dialers = make(map[*dialer]bool)
+	}
+	m.inFlight[key]++
+	if d, ok := c.pool(); ok {
+		m.dialers[d] = true
+	}
+	return &metricsSpan{m: m, host: host, start: time.Now()}
+}
+
+// metricsSpan counts the end of a request.
+type metricsSpan struct {
+	m     *Metrics
+	host  string
+	start time.Time
+}
+
+func (s *metricsSpan) End(info SpanInfo) {
+	d := time.Since(s.start).Seconds()
+	status := "error"
+	if info.StatusCode > 0 {
+		status = strconv.Itoa(info.StatusCode/100) + "xx"
+	}
+	m := s.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[[2]string{s.host, info.Method}]--
+	l := requestLabels{s.host, info.Method, status}
+	r := m.requests[l]
+	if r == nil {
+		r = &requestMetrics{buckets: make([]int64, len(m.buckets()))}
+		m.requests[l] = r
+	}
+	r.count++
+	r.sent += info.BytesSent
+	r.received += info.BytesReceived
+	r.durationSeconds += d
+	for i, le := range m.buckets() {
+		if d <= le {
+			r.buckets[i]++
+		}
+	}
+}
+
+func (m *Metrics) buckets() []float64 {
+	if m.Buckets == nil {
+		return DefaultBuckets
+	}
+	return m.Buckets
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w stdhttp.ResponseWriter, _ *stdhttp.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	requests := make(map[requestLabels]requestMetrics, len(m.requests))
+	for l, r := range m.requests {
+		r := *r
+		r.buckets = append([]int64(nil), r.buckets...)
+		requests[l] = r
+	}
+	inFlight := make(map[[2]string]int64, len(m.inFlight))
+	for k, v := range m.inFlight {
+		inFlight[k] = v
+	}
+	pools := make(map[string]PoolStats)
+	for d := range m.dialers {
+		for key, s := range d.stats() {
+			p := pools[key]
+			p.Idle += s.Idle
+			p.Active += s.Active
+			p.Waiting += s.Waiting
+			p.Dialed += s.Dialed
+			p.Reused += s.Reused
+			p.Closed += s.Closed
+			p.Evicted += s.Evicted
+			pools[key] = p
+		}
+	}
+	m.mu.Unlock()
+
+	// the bytes are counted as they reach w, not the buffer.
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	e := &exposition{w: bw}
+	labels := make([]requestLabels, 0, len(requests))
+	for l := range requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	rlabels := func(l requestLabels) []string {
+		return []string{"host", l.host, "method", l.method, "status", l.status}
+	}
+
+	e.family("gorilla_http_requests_total", "counter", "Requests made, by host, method and status class.")
+	for _, l := range labels {
+		e.sample("gorilla_http_requests_total", rlabels(l), float64(requests[l].count))
+	}
+	e.family("gorilla_http_request_duration_seconds", "histogram", "Time from the start of a request until its response body is read or closed.")
+	for _, l := range labels {
+		r := requests[l]
+		for i, le := range m.buckets() {
+			e.sample("gorilla_http_request_duration_seconds_bucket", append(rlabels(l), "le", formatFloat(le)), float64(r.buckets[i]))
+		}
+		e.sample("gorilla_http_request_duration_seconds_bucket", append(rlabels(l), "le", "+Inf"), float64(r.count))
+		e.sample("gorilla_http_request_duration_seconds_sum", rlabels(l), r.durationSeconds)
+		e.sample("gorilla_http_request_duration_seconds_count", rlabels(l), float64(r.count))
+	}
+	e.family("gorilla_http_request_bytes_total", "counter", "Bytes of request bodies sent, after compression.")
+	for _, l := range labels {
+		e.sample("gorilla_http_request_bytes_total", rlabels(l), float64(requests[l].sent))
+	}
+	e.family("gorilla_http_response_bytes_total", "counter", "Bytes of response bodies read, after decoding.")
+	for _, l := range labels {
+		e.sample("gorilla_http_response_bytes_total", rlabels(l), float64(requests[l].received))
+	}
+
+	keys := make([][2]string, 0, len(inFlight))
+	for k := range inFlight {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	e.family("gorilla_http_requests_in_flight", "gauge", "Requests started whose response body has not been read or closed.")
+	for _, k := range keys {
+		e.sample("gorilla_http_requests_in_flight", []string{"host", k[0], "method", k[1]}, float64(inFlight[k]))
+	}
+
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.family("gorilla_http_pool_connections", "gauge", "Connections in each pool, by state.")
+	for _, name := range names {
+		e.sample("gorilla_http_pool_connections", []string{"pool", name, "state", "idle"}, float64(pools[name].Idle))
+		e.sample("gorilla_http_pool_connections", []string{"pool", name, "state", "active"}, float64(pools[name].Active))
+	}
+	e.family("gorilla_http_pool_waiting", "gauge", "Requests waiting for a connection to be dialed.")
+	for _, name := range names {
+		e.sample("gorilla_http_pool_waiting", []string{"pool", name}, float64(pools[name].Waiting))
+	}
+	for _, c := range []struct {
+		name, help string
+		value      func(PoolStats) int64
+	}{
+		{"gorilla_http_pool_dialed_total", "Connections dialed.", func(s PoolStats) int64 { return s.Dialed }},
+		{"gorilla_http_pool_reused_total", "Connections taken from the pool or shared.", func(s PoolStats) int64 { return s.Reused }},
+		{"gorilla_http_pool_closed_total", "Connections closed.", func(s PoolStats) int64 { return s.Closed }},
+		{"gorilla_http_pool_evicted_total", "Connections closed after they were found to be unusable.", func(s PoolStats) int64 { return s.Evicted }},
+	} {
+		e.family(c.name, "counter", c.help)
+		for _, name := range names {
+			e.sample(c.name, []string{"pool", name}, float64(c.value(pools[name])))
+		}
+	}
+	if e.err == nil {
+		e.err = bw.Flush()
+	}
+	return cw.n, e.err
+}
+
+// exposition writes metrics in the Prometheus text exposition format,
+// keeping the first error.
+type exposition struct {
+	w   io.Writer
+	err error
+}
+
+func (e *exposition) family(name, typ, help string) {
+	e.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample of name, with labels given as name, value pairs.
+func (e *exposition) sample(name string, labels []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	for i := 0; i < len(labels); i += 2 {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	if len(labels) > 0 {
+		b.WriteByte('}')
+	}
+	e.printf("%s %s\n", b.String(), formatFloat(value))
+}
+
+func (e *exposition) printf(format string, args ...any) {
+	if e.err == nil {
+		_, e.err = fmt.Fprintf(e.w, format, args...)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
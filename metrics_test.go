@@ -0,0 +1,126 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	stdurl "net/url"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+	m := &Metrics{Buckets: []float64{60}}
+	c := &Client{dialer: new(dialer), Metrics: m}
+	for _, path := range []string{"/200", "/200", "/404"} {
+		_, _, r, err := c.Get(s.Root()+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(r)
+		r.Close()
+	}
+	if _, _, _, err := c.Get("http://127.0.0.1:1/", nil); err == nil {
+		t.Fatal("Get: expected error")
+	}
+	_, _, open, err := c.Get(s.Root()+"/200", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("expected Content-Type text/plain; version=0.0.4; charset=utf-8, got %q", ct)
+	}
+	u, _ := stdurl.Parse(s.Root())
+	host := u.Host
+	lines := strings.Split(w.Body.String(), "\n")
+	for _, expected := range []string{
+		"# TYPE gorilla_http_requests_total counter",
+		`gorilla_http_requests_total{host="` + host + `",method="GET",status="2xx"} 2`,
+		`gorilla_http_requests_total{host="` + host + `",method="GET",status="4xx"} 1`,
+		`gorilla_http_requests_total{host="127.0.0.1:1",method="GET",status="error"} 1`,
+		"# TYPE gorilla_http_request_duration_seconds histogram",
+		`gorilla_http_request_duration_seconds_bucket{host="` + host + `",method="GET",status="2xx",le="60"} 2`,
+		`gorilla_http_request_duration_seconds_bucket{host="` + host + `",method="GET",status="2xx",le="+Inf"} 2`,
+		`gorilla_http_request_duration_seconds_count{host="` + host + `",method="GET",status="2xx"} 2`,
+		`gorilla_http_request_bytes_total{host="` + host + `",method="GET",status="2xx"} 0`,
+		`gorilla_http_response_bytes_total{host="` + host + `",method="GET",status="2xx"} 4`,
+		`gorilla_http_requests_in_flight{host="` + host + `",method="GET"} 1`,
+		`gorilla_http_requests_in_flight{host="127.0.0.1:1",method="GET"} 0`,
+		`gorilla_http_pool_connections{pool="` + host + `",state="active"} 1`,
+		`gorilla_http_pool_connections{pool="` + host + `",state="idle"} 0`,
+		`gorilla_http_pool_dialed_total{pool="` + host + `"} 1`,
+		`gorilla_http_pool_reused_total{pool="` + host + `"} 3`,
+	} {
+		if !contains(lines, expected) {
+			t.Errorf("expected line %q in:\n%s", expected, w.Body)
+		}
+	}
+}
+
+// WriteTo returns the bytes written to w, including those of a failed write.
+func TestMetricsWriteTo(t *testing.T) {
+	m := new(Metrics)
+	m.start(new(Client), "GET", "http://example.com/").End(SpanInfo{Method: "GET", StatusCode: 200})
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) {
+		t.Errorf("WriteTo: expected %d, nil, got %d, %v", b.Len(), n, err)
+	}
+	lw := &limitedWriter{n: 100}
+	if n, err := m.WriteTo(lw); err != errShortWrite || n != 100 {
+		t.Errorf("WriteTo: expected 100, %v, got %d, %v", errShortWrite, n, err)
+	}
+}
+
+var errShortWrite = errors.New("short write")
+
+// limitedWriter accepts n bytes, then fails.
+type limitedWriter struct {
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		n := l.n
+		l.n = 0
+		return n, errShortWrite
+	}
+	l.n -= len(p)
+	return len(p), nil
+}
+
+var expositionTests = []struct {
+	labels   []string
+	expected string
+}{
+	{nil, "metric 1\n"},
+	{[]string{"a", "b"}, "metric{a=\"b\"} 1\n"},
+	{[]string{"a", `"q"`, "b", `c:\d`}, `metric{a="\"q\"",b="c:\\d"} 1` + "\n"},
+	{[]string{"a", "x\ny"}, `metric{a="x\ny"} 1` + "\n"},
+}
+
+func TestExpositionSample(t *testing.T) {
+	for _, tt := range expositionTests {
+		var b strings.Builder
+		e := &exposition{w: &b}
+		e.sample("metric", tt.labels, 1)
+		if b.String() != tt.expected {
+			t.Errorf("sample(%q): expected %q, got %q", tt.labels, tt.expected, b.String())
+		}
+	}
+}
+
+func contains(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/http/client"
+)
+
+// Multipart builds a multipart/form-data request body, rfc 7578. Parts are
+// streamed from the readers they were added with as the body is read, nothing
+// is buffered. Once reading has begun no more parts may be added.
+//
+//	m := http.NewMultipart()
+//	m.AddField("title", "holiday")
+//	m.AddFile("photo", "beach.jpg", f)
+//	status, _, r, err := c.Post(url, m.Headers(), m)
+type Multipart struct {
+	boundary string
+	parts    []io.Reader
+	length   int64 // the length of the body, or -1 if unknown
+	r        io.Reader
+}
+
+// NewMultipart returns an empty Multipart with a random boundary.
+func NewMultipart() *Multipart {
+	var b [30]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(err)
+	}
+	return &Multipart{boundary: fmt.Sprintf("%x", b[:])}
+}
+
+// Boundary returns the boundary which separates the parts.
+func (m *Multipart) Boundary() string { return m.boundary }
+
+// SetBoundary overrides the random boundary. It must be called before any
+// parts are added, and b must be a valid boundary, rfc 2046 s5.1.1.
+func (m *Multipart) SetBoundary(b string) error {
+	if len(m.parts) > 0 {
+		return errors.New("multipart: SetBoundary called after parts were added")
+	}
+	// borrow the validation of mime/multipart.
+	if err := multipart.NewWriter(io.Discard).SetBoundary(b); err != nil {
+		return err
+	}
+	m.boundary = b
+	return nil
+}
+
+// ContentType returns the Content-Type of the body, including its boundary.
+func (m *Multipart) ContentType() string {
+	b := m.boundary
+	if strings.ContainsAny(b, `()<>@,;:\"/[]?= `) {
+		b = `"` + b + `"`
+	}
+	return "multipart/form-data; boundary=" + b
+}
+
+// Size returns the length of the body, or -1 if the length of a part is
+// unknown, in which case the body is sent using chunked encoding. As it has a
+// Size method, the length of a Multipart used as the Body of a client.Request
+// is known without setting Length.
+func (m *Multipart) Size() int64 {
+	if m.length < 0 {
+		return -1
+	}
+	return m.length + int64(len(m.closing()))
+}
+
+// Headers returns the request headers for the body, its Content-Type and,
+// if known, Content-Length. It should be called once all the parts have been added.
+func (m *Multipart) Headers() map[string][]string {
+	h := map[string][]string{"Content-Type": {m.ContentType()}}
+	if l := m.Size(); l >= 0 {
+		h["Content-Length"] = []string{strconv.FormatInt(l, 10)}
+	}
+	return h
+}
+
+// AddField adds a form field with the given name and value.
+func (m *Multipart) AddField(name, value string) error {
+	h := map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(name))},
+	}
+	return m.AddPart(h, strings.NewReader(value))
+}
+
+// AddFile adds a file field with the given name and filename whose contents are
+// read from r. The Content-Type of the part is guessed from the extension of
+// filename, defaulting to application/octet-stream. If r is an io.Closer it is
+// not closed.
+func (m *Multipart) AddFile(name, filename string, r io.Reader) error {
+	ct := mime.TypeByExtension(filepath.Ext(filename))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	h := map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(name), escapeQuotes(filename))},
+		"Content-Type":        {ct},
+	}
+	return m.AddPart(h, r)
+}
+
+// AddPart adds a part with the given headers whose contents are read from r.
+// The length of r is determined as for client.Request.ContentLength.
+func (m *Multipart) AddPart(headers map[string][]string, r io.Reader) error {
+	if m.r != nil {
+		return errors.New("multipart: part added after reading began")
+	}
+	keys := make([]string, 0, len(headers))
+	for k, v := range headers {
+		for _, v := range v {
+			if strings.ContainsAny(k, "\r\n:") || strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("multipart: invalid part header %q: %q", k, v)
+			}
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	if len(m.parts) > 0 {
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s\r\n", m.boundary)
+	for _, k := range keys {
+		for _, v := range headers[k] {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	b.WriteString("\r\n")
+	m.parts = append(m.parts, strings.NewReader(b.String()), r)
+	if m.length >= 0 {
+		if l := client.BodyLength(r); l >= 0 {
+			m.length += int64(b.Len()) + l
+		} else {
+			m.length = -1
+		}
+	}
+	return nil
+}
+
+func (m *Multipart) closing() string {
+	if len(m.parts) == 0 {
+		return "--" + m.boundary + "--\r\n"
+	}
+	return "\r\n--" + m.boundary + "--\r\n"
+}
+
+// Read reads the encoded body.
+func (m *Multipart) Read(buf []byte) (int, error) {
+	if m.r == nil {
+		m.r = io.MultiReader(append(m.parts, strings.NewReader(m.closing()))...)
+	}
+	return m.r.Read(buf)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	stdhttp "net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/http/client"
+)
+
+// onlyReader hides the length of a reader.
+type onlyReader struct{ io.Reader }
+
+func TestMultipart(t *testing.T) {
+	m := NewMultipart()
+	if err := m.SetBoundary("gorilla boundary"); err != nil {
+		t.Fatal(err)
+	}
+	m.AddField("title", `a "quoted" title`)
+	m.AddFile("photo", "beach.png", strings.NewReader("png data"))
+	m.AddPart(map[string][]string{"Content-Disposition": {`form-data; name="raw"`}, "X-Part": {"1"}}, bytes.NewReader([]byte("raw\r\n--data")))
+	if err := m.AddPart(map[string][]string{"X-Bad": {"a\r\nb"}}, strings.NewReader("")); err == nil {
+		t.Error("AddPart: expected error for invalid header")
+	}
+
+	length := m.Size()
+	body, err := io.ReadAll(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(body)) != length {
+		t.Errorf("Size: expected %d, got %d", len(body), length)
+	}
+	if err := m.AddField("late", ""); err == nil {
+		t.Error("AddField: expected error after reading began")
+	}
+
+	mt, params, err := mime.ParseMediaType(m.ContentType())
+	if err != nil || mt != "multipart/form-data" || params["boundary"] != "gorilla boundary" {
+		t.Fatalf("ContentType: unexpected %q, %v", m.ContentType(), err)
+	}
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	expected := []struct{ name, filename, contentType, header, data string }{
+		{"title", "", "", "", `a "quoted" title`},
+		{"photo", "beach.png", "image/png", "", "png data"},
+		{"raw", "", "", "1", "raw\r\n--data"},
+	}
+	for _, e := range expected {
+		p, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(p)
+		if p.FormName() != e.name || p.FileName() != e.filename || p.Header.Get("Content-Type") != e.contentType || p.Header.Get("X-Part") != e.header || string(data) != e.data {
+			t.Errorf("NextPart: expected %v, got %q %q %v %q", e, p.FormName(), p.FileName(), p.Header, data)
+		}
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Errorf("NextPart: expected EOF, got %v", err)
+	}
+}
+
+func TestMultipartEmpty(t *testing.T) {
+	m := NewMultipart()
+	body, _ := io.ReadAll(m)
+	if int64(len(body)) != m.Size() {
+		t.Errorf("Size: expected %d, got %d", len(body), m.Size())
+	}
+	if _, err := multipart.NewReader(bytes.NewReader(body), m.Boundary()).NextPart(); err != io.EOF {
+		t.Errorf("NextPart: expected EOF, got %v", err)
+	}
+}
+
+// a Multipart sent as a client.Request body has a Content-Length.
+func TestMultipartRequest(t *testing.T) {
+	m := NewMultipart()
+	m.AddField("name", "gorilla")
+	var b bytes.Buffer
+	c := client.NewClient(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(""), &b})
+	req := &client.Request{Method: "POST", Path: "/", Version: client.HTTP_1_1, Body: m}
+	size := m.Size()
+	if err := c.WriteRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	head, body, _ := strings.Cut(b.String(), "\r\n\r\n")
+	if expected := fmt.Sprintf("\r\nContent-Length: %d", size); !strings.Contains(head, expected) || strings.Contains(head, "Transfer-Encoding") || int64(len(body)) != size {
+		t.Errorf("WriteRequest: expected %q and a %d byte body, got %q", expected, size, b.String())
+	}
+}
+
+func TestMultipartPost(t *testing.T) {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/upload", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			stdhttp.Error(w, err.Error(), stdhttp.StatusBadRequest)
+			return
+		}
+		f, fh, err := r.FormFile("file")
+		if err != nil {
+			stdhttp.Error(w, err.Error(), stdhttp.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		n, _ := io.Copy(io.Discard, f)
+		fmt.Fprintf(w, "%d %v %s %s %d", r.ContentLength, r.TransferEncoding, r.FormValue("name"), fh.Filename, n)
+	})
+	s := newServer(t, mux)
+	defer s.Shutdown()
+
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0xff}, 100000), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, sized := range []bool{true, false} {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := NewMultipart()
+		m.AddField("name", "gorilla")
+		if sized {
+			m.AddFile("file", "data.bin", f)
+		} else {
+			m.AddFile("file", "data.bin", onlyReader{f})
+		}
+		var c Client
+		status, _, r, err := c.Post(s.Root()+"/upload", m.Headers(), m)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		expected := fmt.Sprintf("%d [] gorilla data.bin 100000", m.Size())
+		if !sized {
+			expected = "-1 [chunked] gorilla data.bin 100000"
+		}
+		if status.Code != 200 || string(b) != expected {
+			t.Errorf("Post(sized %v): expected %q, got %v %q", sized, expected, status, b)
+		}
+	}
+}
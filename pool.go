@@ -0,0 +1,147 @@
+package http
+
+import (
+	"net"
+)
+
+// PoolStats describes the connections of a single pool. Connections are
+// pooled by host and port, with https connections pooled separately under
+// "tls:host:port" and HTTP/2 over plain TCP under "h2c:host:port".
+type PoolStats struct {
+	// Idle is the number of connections waiting in the pool to be reused.
+	Idle int
+
+	// Active is the number of connections in use by a request. A shared
+	// HTTP/2 connection counts once, however many requests it carries.
+	Active int
+
+	// Waiting is the number of requests waiting for a connection to be dialed.
+	Waiting int
+
+	// Dialed, Reused, Closed and Evicted count the connections dialed, taken
+	// from the pool or shared, closed, and closed after they were found to be
+	// unusable, since the pool was created.
+	Dialed, Reused, Closed, Evicted int64
+}
+
+// PoolHooks are called as the connections of a Client are dialed, reused,
+// released to the pool, closed and evicted. Hooks are passed the name of the
+// pool, as described by PoolStats, and the connection. They are called
+// synchronously, so must not block.
+type PoolHooks struct {
+	OnDial    func(pool string, c net.Conn)
+	OnReuse   func(pool string, c net.Conn)
+	OnRelease func(pool string, c net.Conn)
+
+	// OnClose is called for every connection closed, including those evicted.
+	OnClose func(pool string, c net.Conn)
+
+	// OnEvict is called when a connection is closed because it was found to
+	// be unusable, such as an idle connection closed by the server or a
+	// HTTP/2 connection which can take no new requests.
+	OnEvict func(pool string, c net.Conn)
+}
+
+// Stats returns the statistics of each connection pool used by c.
+func (c *Client) Stats() map[string]PoolStats {
+	d, ok := c.pool()
+	if !ok {
+		return nil
+	}
+	return d.stats()
+}
+
+// SetPoolHooks sets the hooks called for the connections of c. Clients
+// copied from c, such as by WithLimits, share its connections and hooks.
+func (c *Client) SetPoolHooks(h PoolHooks) {
+	if d, ok := c.pool(); ok {
+		d.Lock()
+		d.hooks = h
+		d.Unlock()
+	}
+}
+
+// pool returns the dialer of c, if it is one which pools connections.
+func (c *Client) pool() (*dialer, bool) {
+	if c.dialer == nil {
+		return defaultDialer, true
+	}
+	d, ok := c.dialer.(*dialer)
+	return d, ok
+}
+
+// poolStats holds the counters of a single pool.
+type poolStats struct {
+	active, waiting                 int
+	dialed, reused, closed, evicted int64
+	h2                              net.Conn // the connection carrying the shared HTTP/2 connection, if any
+}
+
+// pool returns the counters of the pool key. The dialer must be locked.
+func (d *dialer) pool(key string) *poolStats {
+	if d.counters == nil {
+		d.counters = make(map[string]*poolStats)
+	}
+	p := d.counters[key]
+	if p == nil {
+		p = new(poolStats)
+		d.counters[key] = p
+	}
+	return p
+}
+
+func (d *dialer) stats() map[string]PoolStats {
+	d.Lock()
+	defer d.Unlock()
+	stats := make(map[string]PoolStats, len(d.counters))
+	for key, p := range d.counters {
+		s := PoolStats{
+			Idle:    len(d.conns[key]),
+			Active:  p.active,
+			Waiting: p.waiting,
+			Dialed:  p.dialed,
+			Reused:  p.reused,
+			Closed:  p.closed,
+			Evicted: p.evicted,
+		}
+		if d.h2[key] != nil {
+			s.Active++
+		}
+		stats[key] = s
+	}
+	return stats
+}
+
+// hook calls h, if set. The dialer must not be locked, so h may call Stats.
+func (d *dialer) hook(h func(string, net.Conn), key string, c net.Conn) {
+	if h != nil {
+		h(key, c)
+	}
+}
+
+// dialing counts a request waiting for a connection to the pool key to be
+// dialed. The returned func must be called once the dial has completed.
+func (d *dialer) dialing(key string) func() {
+	d.Lock()
+	d.pool(key).waiting++
+	d.Unlock()
+	return func() {
+		d.Lock()
+		d.pool(key).waiting--
+		d.Unlock()
+	}
+}
+
+// dialed counts a newly dialed connection to the pool key, which is active
+// unless it carries a shared HTTP/2 connection.
+func (d *dialer) dialed(key string, c net.Conn, h2 bool) {
+	d.Lock()
+	p := d.pool(key)
+	p.dialed++
+	if !h2 {
+		p.active++
+	}
+	h := d.hooks.OnDial
+	d.Unlock()
+	d.hook(h, key, c)
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+
+	"github.com/gorilla/http/client"
+)
+
+// maxErrorBody is the most of an error response body captured by a StatusError.
+const maxErrorBody = 8 << 10
+
+// ProblemError is a problem details document, rfc 9457, returned by a server
+// as application/problem+json to describe an error. A *StatusError whose
+// response carried a problem document wraps it, so it may be found with
+// errors.As.
+type ProblemError struct {
+	// Type is a URI reference identifying the problem type. If the
+	// document did not give one it is "about:blank".
+	Type string
+
+	// Title is a short summary of the problem type.
+	Title string
+
+	// Status is the status code given by the document, or zero.
+	Status int
+
+	// Detail explains this occurrence of the problem.
+	Detail string
+
+	// Instance is a URI reference identifying this occurrence of the problem.
+	Instance string
+
+	// Extensions holds any other members of the document.
+	Extensions map[string]interface{}
+}
+
+func (p *ProblemError) Error() string {
+	s := p.Title
+	if s == "" {
+		s = p.Type
+	}
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	return s
+}
+
+// NewStatusError returns a *StatusError for a response with the given status,
+// headers and body, capturing up to 8k of the body. If the body is a problem
+// details document it is decoded into the Problem of the StatusError. The
+// body is not closed.
+func NewStatusError(status client.Status, headers map[string][]string, body io.Reader) *StatusError {
+	e := &StatusError{Status: status, Headers: headers}
+	if body == nil {
+		return e
+	}
+	b, err := io.ReadAll(io.LimitReader(body, maxErrorBody))
+	if err != nil && len(b) == 0 {
+		return e
+	}
+	e.Body = b
+	if mt, _, _ := mime.ParseMediaType(headerValue(headers, "Content-Type")); mt == "application/problem+json" {
+		e.Problem = parseProblem(b)
+	}
+	return e
+}
+
+// parseProblem decodes a problem details document, returning nil if b is not
+// one. Members of the wrong type are ignored, rfc 9457 s3.1.
+func parseProblem(b []byte) *ProblemError {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	p := &ProblemError{Type: "about:blank"}
+	str := func(name string, v *string) {
+		if s, ok := m[name].(string); ok {
+			*v = s
+		}
+		delete(m, name)
+	}
+	str("type", &p.Type)
+	str("title", &p.Title)
+	str("detail", &p.Detail)
+	str("instance", &p.Instance)
+	if n, ok := m["status"].(float64); ok && n == float64(int(n)) {
+		p.Status = int(n)
+	}
+	delete(m, "status")
+	if len(m) > 0 {
+		p.Extensions = m
+	}
+	return p
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"errors"
+	"io"
+	stdhttp "net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/http/client"
+)
+
+var newStatusErrorTests = []struct {
+	contentType string
+	body        string
+	problem     *ProblemError
+	err         string
+}{
+	{"text/plain", "not here", nil, "404 Not Found"},
+	{"application/json", `{"title":"Not Found"}`, nil, "404 Not Found"},
+	{
+		"application/problem+json",
+		`{"type":"https://example.com/probs/out-of-credit","title":"You do not have enough credit.","status":403,"detail":"Your current balance is 30, but that costs 50.","instance":"/account/12345/msgs/abc","balance":30}`,
+		&ProblemError{
+			Type:       "https://example.com/probs/out-of-credit",
+			Title:      "You do not have enough credit.",
+			Status:     403,
+			Detail:     "Your current balance is 30, but that costs 50.",
+			Instance:   "/account/12345/msgs/abc",
+			Extensions: map[string]interface{}{"balance": float64(30)},
+		},
+		"404 Not Found: You do not have enough credit.: Your current balance is 30, but that costs 50.",
+	},
+	{"application/problem+json; charset=utf-8", `{"title":7,"status":"404","detail":"gone"}`, &ProblemError{Type: "about:blank", Detail: "gone"}, "404 Not Found: about:blank: gone"},
+	{"application/problem+json", `not json`, nil, "404 Not Found"},
+}
+
+func TestNewStatusError(t *testing.T) {
+	status := client.Status{Code: 404, Reason: "Not Found"}
+	for _, tt := range newStatusErrorTests {
+		headers := map[string][]string{"Content-Type": {tt.contentType}}
+		err := NewStatusError(status, headers, strings.NewReader(tt.body))
+		if !reflect.DeepEqual(err.Problem, tt.problem) || err.Error() != tt.err || string(err.Body) != tt.body {
+			t.Errorf("NewStatusError(%q, %q): expected %+v %q, got %+v %q", tt.contentType, tt.body, tt.problem, tt.err, err.Problem, err.Error())
+		}
+		var p *ProblemError
+		if errors.As(error(err), &p) != (tt.problem != nil) {
+			t.Errorf("NewStatusError(%q, %q): errors.As(*ProblemError) = %v", tt.contentType, tt.body, p)
+		}
+	}
+}
+
+func TestNewStatusErrorBounded(t *testing.T) {
+	body := strings.NewReader(strings.Repeat("x", 3*maxErrorBody))
+	err := NewStatusError(client.Status{Code: 500, Reason: "Internal Server Error"}, nil, body)
+	if len(err.Body) != maxErrorBody {
+		t.Errorf("NewStatusError: expected %d bytes of body, got %d", maxErrorBody, len(err.Body))
+	}
+}
+
+func TestGetProblem(t *testing.T) {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/problem", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(stdhttp.StatusServiceUnavailable)
+		io.WriteString(w, `{"title":"Down for maintenance"}`)
+	})
+	s := newServer(t, mux)
+	defer s.Shutdown()
+
+	_, err := Get(io.Discard, s.Root()+"/problem")
+	var serr *StatusError
+	var p *ProblemError
+	if !errors.As(err, &serr) || !errors.As(err, &p) {
+		t.Fatalf("Get: expected *StatusError wrapping *ProblemError, got %T %v", err, err)
+	}
+	if serr.Code != 503 || headerValue(serr.Headers, "Retry-After") != "60" || p.Title != "Down for maintenance" {
+		t.Errorf("Get: unexpected error %+v %+v", serr, p)
+	}
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Tracer starts a span for each request made by a Client, so requests may be
+// reported to a tracing system such as OpenTelemetry.
+type Tracer interface {
+	// Start is called as a request begins. It returns the context with
+	// which the request is made, which should carry the TraceParent of the
+	// span if it is to be propagated, and the span, which is ended once the
+	// request is complete.
+	Start(ctx context.Context, method, url string) (context.Context, Span)
+}
+
+// Span is a request started by a Tracer.
+type Span interface {
+	// End is called once, when the response body has been read to EOF or
+	// closed, or the request has failed.
+	End(SpanInfo)
+}
+
+// SpanInfo describes a request traced by a Span.
+type SpanInfo struct {
+	Method, URL string
+
+	// StatusCode is the status of the final response, or zero if there was
+	// none.
+	StatusCode int
+
+	// Retries is the number of times the request was sent again, after the
+	// pooled connection it was sent on failed, or it was refused compressed.
+	Retries int
+
+	// Redirects is the number of redirects followed.
+	Redirects int
+
+	// BytesSent and BytesReceived are the bytes of the request body sent,
+	// after any compression, and of the response body read, once decoded.
+	BytesSent, BytesReceived int64
+
+	// Err is the error which ended the request, or its response body.
+	Err error
+}
+
+// multiSpan ends each of its spans.
+type multiSpan []Span
+
+func (s multiSpan) End(info SpanInfo) {
+	for _, span := range s {
+		span.End(info)
+	}
+}
+
+// requestState counts the attempts made to send a traced request.
+type requestState struct {
+	retries, redirects int
+	sent               int64 // accessed atomically
+}
+
+type requestStateKey struct{}
+
+// addRetry counts a retry of the request made with ctx, if it is traced.
+func addRetry(ctx context.Context) {
+	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		s.retries++
+	}
+}
+
+// addRedirect counts a redirect followed by the request made with ctx, if it is traced.
+func addRedirect(ctx context.Context) {
+	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		s.redirects++
+	}
+}
+
+// countSent returns body, counting the bytes read from it if the request made
+// with ctx is traced.
+func countSent(ctx context.Context, body io.Reader) io.Reader {
+	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok && body != nil {
+		return &sentReader{body, &s.sent}
+	}
+	return body
+}
+
+// sentReader counts the bytes of a request body, which may be read by another
+// goroutine.
+type sentReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (s *sentReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	atomic.AddInt64(s.n, int64(n))
+	return n, err
+}
+
+// spanBody ends a Span once the response body is read to EOF or closed.
+type spanBody struct {
+	io.ReadCloser
+	span  Span
+	state *requestState
+
+	mu   sync.Mutex // protects following fields
+	info SpanInfo
+	done bool
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.info.BytesReceived += int64(n)
+	b.mu.Unlock()
+	switch err {
+	case nil:
+	case io.EOF:
+		b.end(nil)
+	default:
+		b.end(err)
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.end(nil)
+	return err
+}
+
+// end ends the span, if it has not been ended already.
+func (b *spanBody) end(err error) {
+	b.mu.Lock()
+	done, info := b.done, b.info
+	b.done = true
+	b.mu.Unlock()
+	if !done {
+		info.Retries, info.Redirects = b.state.retries, b.state.redirects
+		info.BytesSent = atomic.LoadInt64(&b.state.sent)
+		info.Err = err
+		b.span.End(info)
+	}
+}
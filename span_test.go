@@ -0,0 +1,88 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTracer records the SpanInfo of each span ended, starting each span
+// as a child of the TraceParent of the context.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []SpanInfo
+}
+
+func (r *recordingTracer) Start(ctx context.Context, method, url string) (context.Context, Span) {
+	tp, _ := ContextTraceParent(ctx)
+	tp.SpanID = [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	return WithTraceParent(ctx, tp), r
+}
+
+func (r *recordingTracer) End(info SpanInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, info)
+}
+
+func spanmux() *http.ServeMux {
+	mux := stdmux()
+	mux.HandleFunc("/traceparent", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("traceparent")+" "+r.Header.Get("tracestate"))
+	})
+	return mux
+}
+
+var spanTests = []struct {
+	method, path string
+	body         string
+	expected     SpanInfo
+	response     string
+}{
+	{"GET", "/200", "", SpanInfo{StatusCode: 200, BytesReceived: 2}, "OK"},
+	{"POST", "/201", postBody, SpanInfo{StatusCode: 201, BytesSent: int64(len(postBody)), BytesReceived: 8}, "Created\n"},
+	{"GET", "/301", "", SpanInfo{StatusCode: 200, Redirects: 1, BytesReceived: 2}, "OK"},
+	{"GET", "/traceparent", "", SpanInfo{StatusCode: 200, BytesReceived: 73}, "00-4bf92f3577b34da6a3ce929d0e0e4736-0102030405060708-01 congo=t61rcWkgMzE"},
+}
+
+func TestClientTracer(t *testing.T) {
+	s := newServer(t, spanmux())
+	defer s.Shutdown()
+	tp, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tp.State = "congo=t61rcWkgMzE"
+	ctx := WithTraceParent(context.Background(), tp)
+	for _, tt := range spanTests {
+		tracer := new(recordingTracer)
+		c := &Client{dialer: new(dialer), FollowRedirects: true, Tracer: tracer, PropagateTraceContext: true}
+		var body io.Reader
+		if tt.body != "" {
+			body = strings.NewReader(tt.body)
+		}
+		_, _, r, err := c.DoContext(ctx, tt.method, s.Root()+tt.path, nil, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		if string(b) != tt.response {
+			t.Errorf("%s %s: expected %q, got %q", tt.method, tt.path, tt.response, b)
+		}
+		tt.expected.Method, tt.expected.URL = tt.method, s.Root()+tt.path
+		if len(tracer.spans) != 1 || tracer.spans[0] != tt.expected {
+			t.Errorf("%s %s: expected span %+v, got %+v", tt.method, tt.path, tt.expected, tracer.spans)
+		}
+	}
+
+	// failed requests end their span.
+	tracer := new(recordingTracer)
+	c := &Client{dialer: new(dialer), Tracer: tracer}
+	if _, _, _, err := c.Get("http://127.0.0.1:1/", nil); err == nil {
+		t.Fatal("Get: expected error")
+	}
+	if len(tracer.spans) != 1 || tracer.spans[0].Err == nil || tracer.spans[0].StatusCode != 0 {
+		t.Errorf("Get: expected span with error, got %+v", tracer.spans)
+	}
+}
@@ -0,0 +1,138 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a single event read from an event stream.
+type Event struct {
+	// ID is the last event ID set by the stream, which may have been set by
+	// an earlier event.
+	ID string
+
+	// Type is the event type. It is "message" unless set by the event field.
+	Type string
+
+	// Data is the event data. Multiple data fields are joined by newlines.
+	Data string
+}
+
+// Reader parses events from a text/event-stream, as defined by the HTML
+// Living Standard, section 9.2 Server-sent events.
+type Reader struct {
+	br      *bufio.Reader
+	started bool // the byte order mark, if any, has been skipped
+	cr      bool // the previous line ended with CR, so a leading LF is ignored
+	line    []byte
+	lastID  string
+	retry   time.Duration
+}
+
+// NewReader returns a Reader which parses events read from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{br: bufio.NewReader(r)}
+}
+
+// LastEventID returns the last event ID set by the stream.
+func (r *Reader) LastEventID() string { return r.lastID }
+
+// Retry returns the reconnection time last set by the stream, or zero if none has been set.
+func (r *Reader) Retry() time.Duration { return r.retry }
+
+// Read returns the next event. At the end of the stream io.EOF is returned;
+// an incomplete final event is discarded.
+func (r *Reader) Read() (Event, error) {
+	var typ string
+	var data strings.Builder
+	var hasData bool
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+		if len(line) == 0 {
+			// dispatch the event, unless it has no data.
+			if !hasData {
+				typ = ""
+				continue
+			}
+			if typ == "" {
+				typ = "message"
+			}
+			d := data.String()
+			return Event{ID: r.lastID, Type: typ, Data: d[:len(d)-1]}, nil
+		}
+		if line[0] == ':' {
+			continue // a comment
+		}
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			if len(value) > 0 && value[0] == ' ' {
+				value = value[1:]
+			}
+		}
+		switch string(field) {
+		case "event":
+			typ = string(value)
+		case "data":
+			data.Write(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if bytes.IndexByte(value, 0) < 0 {
+				r.lastID = string(value)
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(string(value), 10, 63); err == nil && isDigits(value) {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// readLine reads a line terminated by CRLF, LF or CR, returning it without
+// the terminator. The returned slice is only valid until the next call.
+func (r *Reader) readLine() ([]byte, error) {
+	if !r.started {
+		r.started = true
+		if bom, err := r.br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+			r.br.Discard(3)
+		}
+	}
+	r.line = r.line[:0]
+	for {
+		c, err := r.br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		cr := r.cr
+		r.cr = false
+		switch c {
+		case '\n':
+			if cr && len(r.line) == 0 {
+				continue // the LF of a CRLF.
+			}
+			return r.line, nil
+		case '\r':
+			r.cr = true
+			return r.line, nil
+		default:
+			r.line = append(r.line, c)
+		}
+	}
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(b) > 0
+}
@@ -0,0 +1,248 @@
+// Package sse implements a client for Server-sent events, streams of events
+// served as text/event-stream, which reconnects as the stream requires.
+package sse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/http"
+	"github.com/gorilla/http/client"
+)
+
+// DefaultRetry is the time waited before reconnecting, unless the stream sets another.
+const DefaultRetry = 3 * time.Second
+
+// Subscription reads events from an event stream, reconnecting when the
+// connection is lost and resuming from the last event ID received. A
+// Subscription is not safe for concurrent use.
+type Subscription struct {
+	client  *http.Client
+	url     string
+	headers map[string][]string
+
+	// Retry is the time waited before reconnecting, until the stream sets
+	// another. If zero, DefaultRetry is used.
+	Retry time.Duration
+
+	// MaxRetries, if non zero, is the number of consecutive failed attempts
+	// to reconnect after which Next gives up, returning the last error.
+	MaxRetries int
+
+	// LastEventID is the ID of the last event received, sent in the
+	// Last-Event-ID header when reconnecting. It may be set before the first
+	// call to Next to resume a stream.
+	LastEventID string
+
+	body      io.ReadCloser
+	r         *Reader
+	connected bool  // the first connection has been made, later ones are reconnections
+	failures  int   // consecutive failed reconnections
+	err       error // the error which ended the subscription
+
+	mu      sync.Mutex
+	chanErr error // the error which closed the channel returned by Events
+}
+
+// errClosed is returned by Next once the Subscription has been closed.
+var errClosed = errors.New("sse: subscription closed")
+
+// Subscribe returns a Subscription to the event stream at url, fetched using c,
+// or http.DefaultClient if c is nil. The connection is made by the first call
+// to Next.
+func Subscribe(c *http.Client, url string, headers map[string][]string) *Subscription {
+	if c == nil {
+		c = &http.DefaultClient
+	}
+	return &Subscription{client: c, url: url, headers: headers}
+}
+
+// Next returns the next event, connecting or reconnecting as required. It
+// returns an error if ctx is done, or if the server responds with anything
+// other than a 200 OK text/event-stream, after which the subscription has
+// ended and Next will return the same error. A server may end the
+// subscription by responding 204 No Content, in which case io.EOF is returned.
+//
+// Cancelling ctx closes the connection, which is reopened by a later call to Next.
+func (s *Subscription) Next(ctx context.Context) (Event, error) {
+	for s.err == nil {
+		if err := ctx.Err(); err != nil {
+			return Event{}, err
+		}
+		if s.body == nil {
+			if err := s.connect(ctx); err != nil {
+				if s.err != nil || ctx.Err() != nil {
+					break
+				}
+				s.failures++
+				if s.MaxRetries > 0 && s.failures >= s.MaxRetries {
+					s.err = err
+					break
+				}
+				continue
+			}
+		}
+		ev, err := s.read(ctx)
+		if err == nil {
+			return ev, nil
+		}
+		// the connection was lost, or ctx cancelled.
+		s.body.Close()
+		s.body = nil
+	}
+	if s.err != nil {
+		return Event{}, s.err
+	}
+	return Event{}, ctx.Err()
+}
+
+// read reads the next event, closing the connection if ctx is done first.
+func (s *Subscription) read(ctx context.Context) (Event, error) {
+	done := make(chan struct{})
+	defer close(done)
+	body := s.body
+	go func() {
+		select {
+		case <-ctx.Done():
+			body.Close()
+		case <-done:
+		}
+	}()
+	ev, err := s.r.Read()
+	if r := s.r.Retry(); r > 0 {
+		s.Retry = r
+	}
+	// an id may have been set by a block with no data.
+	s.LastEventID = s.r.LastEventID()
+	return ev, err
+}
+
+// connect opens the event stream, waiting first if it is a reconnection.
+func (s *Subscription) connect(ctx context.Context) error {
+	if s.connected {
+		if err := s.wait(ctx); err != nil {
+			return err
+		}
+	}
+	s.connected = true
+	headers := make(map[string][]string, len(s.headers)+3)
+	for k, v := range s.headers {
+		headers[k] = v
+	}
+	headers["Accept"] = []string{"text/event-stream"}
+	headers["Cache-Control"] = []string{"no-cache"}
+	if s.LastEventID != "" {
+		headers["Last-Event-ID"] = []string{s.LastEventID}
+	}
+	status, rheaders, body, err := s.client.DoContext(ctx, "GET", s.url, headers, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status.Code == client.SUCCESS_NO_CONTENT:
+		body.Close()
+		s.err = io.EOF
+		return s.err
+	case status.Code != client.SUCCESS_OK:
+		s.err = http.NewStatusError(status, rheaders, body)
+		body.Close()
+		return s.err
+	}
+	if ct := header(rheaders, "Content-Type"); !isEventStream(ct) {
+		body.Close()
+		s.err = fmt.Errorf("sse: unexpected Content-Type %q", ct)
+		return s.err
+	}
+	s.body, s.r = body, NewReader(body)
+	s.r.lastID = s.LastEventID
+	s.failures = 0
+	return nil
+}
+
+// wait waits for the retry time, or until ctx is done.
+func (s *Subscription) wait(ctx context.Context) error {
+	d := s.Retry
+	if d <= 0 {
+		d = DefaultRetry
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Events delivers events on the returned channel until ctx is done or the
+// subscription ends, when the channel is closed and Err reports why. Next and
+// Close must not be called until the channel is closed; cancel ctx to stop it.
+func (s *Subscription) Events(ctx context.Context) <-chan Event {
+	ch := make(chan Event)
+	s.mu.Lock()
+	s.chanErr = nil
+	s.mu.Unlock()
+	go func() {
+		defer close(ch)
+		for {
+			ev, err := s.Next(ctx)
+			if err != nil {
+				s.mu.Lock()
+				s.chanErr = err
+				s.mu.Unlock()
+				return
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				s.mu.Lock()
+				s.chanErr = ctx.Err()
+				s.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Err returns the error which closed the channel returned by Events.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chanErr
+}
+
+// Close closes the connection, if open, ending the subscription.
+func (s *Subscription) Close() error {
+	if s.err == nil {
+		s.err = errClosed
+	}
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
+
+func isEventStream(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mt == "text/event-stream"
+}
+
+// header returns the value of the header key, matched case insensitively.
+func header(headers map[string][]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return strings.Join(v, ", ")
+		}
+	}
+	return ""
+}
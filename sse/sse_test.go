@@ -0,0 +1,195 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/http"
+)
+
+var readTests = []struct {
+	stream string
+	events []Event
+	id     string
+	retry  time.Duration
+}{
+	{"", nil, "", 0},
+	{"data: hello\n\n", []Event{{Type: "message", Data: "hello"}}, "", 0},
+	{"data:hello\r\n\r\n", []Event{{Type: "message", Data: "hello"}}, "", 0},
+	{"data: hello\r\rdata: world\r\r", []Event{{Type: "message", Data: "hello"}, {Type: "message", Data: "world"}}, "", 0},
+	{"\xef\xbb\xbfdata: bom\n\n", []Event{{Type: "message", Data: "bom"}}, "", 0},
+	{"data: a\ndata\ndata:  b\n\n", []Event{{Type: "message", Data: "a\n\n b"}}, "", 0},
+	{": comment\nevent: ping\ndata: {}\n\n", []Event{{Type: "ping", Data: "{}"}}, "", 0},
+	{"event: ignored\n\ndata: x\n\n", []Event{{Type: "message", Data: "x"}}, "", 0},
+	{"id: 1\ndata: x\n\nid: 2\n\ndata: y\n\n", []Event{{ID: "1", Type: "message", Data: "x"}, {ID: "2", Type: "message", Data: "y"}}, "2", 0},
+	{"id: a\x00b\ndata: x\n\n", []Event{{Type: "message", Data: "x"}}, "", 0},
+	{"retry: 1500\nretry: 1.5\nretry: -1\n\n", nil, "", 1500 * time.Millisecond},
+	{"data: unterminated\n", nil, "", 0},
+	{"unknown: field\ndata: x\n\n", []Event{{Type: "message", Data: "x"}}, "", 0},
+}
+
+func TestReader(t *testing.T) {
+	for _, tt := range readTests {
+		r := NewReader(strings.NewReader(tt.stream))
+		var events []Event
+		for {
+			ev, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Read(%q): %v", tt.stream, err)
+			}
+			events = append(events, ev)
+		}
+		if !reflect.DeepEqual(events, tt.events) || r.LastEventID() != tt.id || r.Retry() != tt.retry {
+			t.Errorf("Read(%q): expected %v %q %v, got %v %q %v", tt.stream, tt.events, tt.id, tt.retry, events, r.LastEventID(), r.Retry())
+		}
+	}
+}
+
+// counter serves one event per connection, then ends the response so the
+// client must reconnect, recording the Last-Event-ID of each request.
+type counter struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (c *counter) ServeHTTP(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	c.mu.Lock()
+	c.seen = append(c.seen, r.Header.Get("Last-Event-ID"))
+	n := len(c.seen)
+	c.mu.Unlock()
+	if r.Header.Get("Accept") != "text/event-stream" {
+		stdhttp.Error(w, "not acceptable", stdhttp.StatusNotAcceptable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	fmt.Fprintf(w, "retry: 10\nid: %d\ndata: event %d\n\n", n, n)
+}
+
+func TestSubscriptionReconnect(t *testing.T) {
+	var c counter
+	s := httptest.NewServer(&c)
+	defer s.Close()
+
+	sub := Subscribe(nil, s.URL, nil)
+	defer sub.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 1; i <= 3; i++ {
+		ev, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (Event{ID: fmt.Sprint(i), Type: "message", Data: fmt.Sprint("event ", i)}); ev != want {
+			t.Fatalf("Next: expected %v, got %v", want, ev)
+		}
+	}
+	if sub.Retry != 10*time.Millisecond {
+		t.Errorf("Retry: expected 10ms, got %v", sub.Retry)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if want := []string{"", "1", "2"}; !reflect.DeepEqual(c.seen, want) {
+		t.Errorf("Last-Event-ID: expected %q, got %q", want, c.seen)
+	}
+}
+
+func TestSubscriptionStatus(t *testing.T) {
+	s := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(stdhttp.StatusNoContent)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<p>")
+		default:
+			stdhttp.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	var statusErr *http.StatusError
+	for path, check := range map[string]func(error) bool{
+		"/gone":    func(err error) bool { return err == io.EOF },
+		"/html":    func(err error) bool { return err != nil && strings.Contains(err.Error(), "Content-Type") },
+		"/missing": func(err error) bool { return errors.As(err, &statusErr) && statusErr.Code == 404 },
+	} {
+		sub := Subscribe(nil, s.URL+path, nil)
+		if _, err := sub.Next(context.Background()); !check(err) {
+			t.Errorf("Next(%q): unexpected error %v", path, err)
+		}
+		// the error is permanent.
+		if _, err := sub.Next(context.Background()); !check(err) {
+			t.Errorf("Next(%q): unexpected error %v on second call", path, err)
+		}
+	}
+}
+
+// a connection whose response headers never arrive is ended by cancelling Next.
+func TestSubscriptionConnectCancel(t *testing.T) {
+	s := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	sub := Subscribe(nil, s.URL, nil)
+	defer sub.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := sub.Next(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Next: expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next: not ended by ctx")
+	}
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	ready := make(chan struct{})
+	s := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(stdhttp.Flusher).Flush()
+		close(ready)
+		<-r.Context().Done() // hold the stream open until the client goes.
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := Subscribe(nil, s.URL, nil)
+	ch := sub.Events(ctx)
+	if ev := <-ch; ev.Data != "first" {
+		t.Fatalf("Events: expected first, got %v", ev)
+	}
+	<-ready
+	cancel()
+	select {
+	case ev, ok := <-ch:
+		if ok {
+			t.Fatalf("Events: unexpected %v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Events: channel not closed after cancel")
+	}
+	if err := sub.Err(); err != context.Canceled {
+		t.Errorf("Err: expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,158 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Stream decodes a sequence of JSON values of type T from a response body, one
+// at a time, without buffering the whole body. The body may hold either
+// newline delimited JSON, or any whitespace separated JSON values, or a single
+// top level JSON array whose elements are decoded in turn.
+//
+// The body is closed when the stream ends, when decoding fails, or when Close
+// is called.
+//
+//	s := http.NewStream[Record](body)
+//	for s.Next() {
+//		r := s.Value()
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+type Stream[T any] struct {
+	body io.ReadCloser
+	br   *bufio.Reader
+	dec  *json.Decoder
+
+	started bool // the first value has been looked for
+	array   bool // the values are elements of a top level array
+	done    bool // the body has been closed
+	value   T
+	err     error
+}
+
+// NewStream returns a Stream which decodes values of type T read from body.
+func NewStream[T any](body io.ReadCloser) *Stream[T] {
+	br := bufio.NewReader(body)
+	return &Stream[T]{body: body, br: br, dec: json.NewDecoder(br)}
+}
+
+// GetStream sends a GET request using c, or if c is nil the DefaultClient,
+// with DefaultLimits unless it has its own, and returns a Stream decoding the
+// response body. If the response status is not a success the body is closed
+// and a *StatusError returned.
+func GetStream[T any](c *Client, url string, headers map[string][]string) (*Stream[T], error) {
+	if c == nil {
+		c = defaultClient()
+	}
+	status, rheaders, body, err := c.Get(url, headers)
+	if err != nil {
+		return nil, err
+	}
+	if !status.IsSuccess() {
+		defer body.Close()
+		return nil, NewStatusError(status, rheaders, body)
+	}
+	return NewStream[T](body), nil
+}
+
+// Next decodes the next value, which is then available from Value. It returns
+// false once the stream is exhausted or an error occurs, after which the body
+// has been closed and Err reports any error.
+func (s *Stream[T]) Next() bool {
+	if s.done {
+		return false
+	}
+	if !s.started {
+		s.started = true
+		if err := s.begin(); err != nil {
+			s.fail(err)
+			return false
+		}
+	}
+	if s.array && !s.dec.More() {
+		// consume the closing bracket.
+		if _, err := s.dec.Token(); err != nil {
+			s.fail(err)
+			return false
+		}
+		s.fail(nil)
+		return false
+	}
+	var v T
+	if err := s.dec.Decode(&v); err != nil {
+		if err == io.EOF && !s.array {
+			err = nil
+		} else if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		s.fail(err)
+		return false
+	}
+	s.value = v
+	return true
+}
+
+// begin looks at the first significant byte of the body to decide whether it
+// holds a top level array, consuming its opening bracket if so.
+func (s *Stream[T]) begin() error {
+	for {
+		c, err := s.br.ReadByte()
+		if err == io.EOF {
+			return nil // an empty stream.
+		}
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		if err := s.br.UnreadByte(); err != nil {
+			return err
+		}
+		if c != '[' {
+			return nil
+		}
+		s.array = true
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("stream: expected '[', got %v", tok)
+		}
+		return nil
+	}
+}
+
+// fail ends the stream, recording err and closing the body.
+func (s *Stream[T]) fail(err error) {
+	s.done = true
+	s.err = err
+	var zero T
+	s.value = zero
+	if cerr := s.body.Close(); s.err == nil {
+		s.err = cerr
+	}
+}
+
+// Value returns the value decoded by the last successful call to Next.
+func (s *Stream[T]) Value() T { return s.value }
+
+// Err returns the error, if any, which ended the stream.
+func (s *Stream[T]) Err() error { return s.err }
+
+// Close stops the stream early, closing the body. It is safe to call Close
+// after the stream has ended.
+func (s *Stream[T]) Close() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	return s.body.Close()
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"errors"
+	"io"
+	stdhttp "net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type record struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// closeCounter counts calls to Close.
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error { c.closed++; return nil }
+
+var streamTests = []struct {
+	body     string
+	expected []record
+	err      bool
+}{
+	{"", nil, false},
+	{"  \n", nil, false},
+	{`{"id":1,"name":"a"}` + "\n" + `{"id":2,"name":"b"}` + "\n", []record{{1, "a"}, {2, "b"}}, false},
+	{`{"id":1}{"id":2}`, []record{{ID: 1}, {ID: 2}}, false},
+	{"\r\n[ {\"id\":1}, {\"id\":2} ]\n", []record{{ID: 1}, {ID: 2}}, false},
+	{"[]", nil, false},
+	{`{"id":1}` + "\n" + `{"id":`, []record{{ID: 1}}, true},
+	{`[{"id":1},{"id":2}`, []record{{ID: 1}, {ID: 2}}, true},
+	{`[{"id":1} {"id":2}]`, []record{{ID: 1}}, true},
+	{`{"id":"one"}`, nil, true},
+}
+
+func TestStream(t *testing.T) {
+	for _, tt := range streamTests {
+		body := &closeCounter{Reader: strings.NewReader(tt.body)}
+		s := NewStream[record](body)
+		var actual []record
+		for s.Next() {
+			actual = append(actual, s.Value())
+		}
+		if !reflect.DeepEqual(actual, tt.expected) || (s.Err() != nil) != tt.err {
+			t.Errorf("Stream(%q): expected %v, error %v, got %v, %v", tt.body, tt.expected, tt.err, actual, s.Err())
+		}
+		if s.Next() {
+			t.Errorf("Stream(%q): Next after end returned true", tt.body)
+		}
+		if err := s.Close(); err != nil || body.closed != 1 {
+			t.Errorf("Stream(%q): expected body closed once, got %d, %v", tt.body, body.closed, err)
+		}
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	body := &closeCounter{Reader: strings.NewReader(`[{"id":1},{"id":2}]`)}
+	s := NewStream[record](body)
+	if !s.Next() || s.Value().ID != 1 {
+		t.Fatalf("Next: expected record 1, got %v, %v", s.Value(), s.Err())
+	}
+	if err := s.Close(); err != nil || body.closed != 1 {
+		t.Fatalf("Close: expected body closed, got %d, %v", body.closed, err)
+	}
+	if s.Next() || s.Err() != nil {
+		t.Errorf("Next after Close: expected false, nil, got true or %v", s.Err())
+	}
+}
+
+func TestGetStream(t *testing.T) {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/export", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 0; i < 1000; i++ {
+			io.WriteString(w, `{"id":1,"name":"`+strings.Repeat("x", 100)+`"}`+"\n")
+		}
+	})
+	s := newServer(t, mux)
+	defer s.Shutdown()
+
+	stream, err := GetStream[record](nil, s.Root()+"/export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for stream.Next() {
+		n++
+	}
+	if n != 1000 || stream.Err() != nil {
+		t.Errorf("GetStream: expected 1000 records, got %d, %v", n, stream.Err())
+	}
+
+	_, err = GetStream[record](nil, s.Root()+"/404", nil)
+	if err == nil || err.Error() != "404 Not Found" {
+		t.Errorf("GetStream: expected 404 Not Found, got %v", err)
+	}
+}
+
+func TestGetStreamDefaultLimits(t *testing.T) {
+	mux := stdhttp.NewServeMux()
+	mux.HandleFunc("/export", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		io.WriteString(w, `"`+strings.Repeat("x", 100)+`"`)
+	})
+	s := newServer(t, mux)
+	defer s.Shutdown()
+	defer func(l Limits) { DefaultLimits = l }(DefaultLimits)
+	DefaultLimits = Limits{MaxDecodedSize: 10}
+
+	stream, err := GetStream[string](nil, s.Root()+"/export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	var lerr *LimitError
+	if stream.Next() || !errors.As(stream.Err(), &lerr) {
+		t.Errorf("GetStream: expected LimitError, got %v", stream.Err())
+	}
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/gorilla/http/client"
+)
+
+func traceGetConn(ctx context.Context, hostPort string) {
+	if t := client.ContextTrace(ctx); t != nil && t.GetConn != nil {
+		t.GetConn(hostPort)
+	}
+}
+
+// gotConn traces, and logs, the connection c to the pool obtained for the
+// request made with ctx.
+func gotConn(ctx context.Context, pool string, c net.Conn, reused bool) {
+	if t := client.ContextTrace(ctx); t != nil && t.GotConn != nil {
+		t.GotConn(client.ConnInfo{Conn: c, Reused: reused})
+	}
+	msg := "dialed connection"
+	if reused {
+		msg = "reused connection"
+	}
+	logEvent(ctx, levelDebug, msg, "pool", pool, "local", c.LocalAddr(), "remote", c.RemoteAddr())
+}
+
+// tracedBody calls the BodyDone hook of a Trace once a response body ends.
+type tracedBody struct {
+	r      io.Reader
+	closer io.Closer
+	t      *client.Trace
+
+	mu   sync.Mutex // protects following fields
+	n    int64
+	done bool
+}
+
+// traceBody returns body, and its closer, which call the BodyDone hook of t.
+func traceBody(t *client.Trace, body io.Reader, closer io.Closer) (io.Reader, io.Closer) {
+	if t == nil || t.BodyDone == nil {
+		return body, closer
+	}
+	b := &tracedBody{r: body, closer: closer, t: t}
+	return b, b
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.mu.Lock()
+	b.n += int64(n)
+	b.mu.Unlock()
+	switch err {
+	case nil:
+	case io.EOF:
+		b.finish(nil)
+	default:
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	b.finish(errBodyClosed)
+	return b.closer.Close()
+}
+
+// finish calls BodyDone, if it has not been called already.
+func (b *tracedBody) finish(err error) {
+	b.mu.Lock()
+	done, n := b.done, b.n
+	b.done = true
+	b.mu.Unlock()
+	if !done {
+		b.t.BodyDone(n, err)
+	}
+}
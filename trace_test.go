@@ -0,0 +1,219 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/http/client"
+)
+
+// traceEvents returns a Trace recording the name of each hook called.
+func traceEvents() (*client.Trace, func() []string) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	t := &client.Trace{
+		GetConn: func(string) { record("GetConn") },
+		GotConn: func(info client.ConnInfo) {
+			if info.Reused {
+				record("GotConn(reused)")
+			} else {
+				record("GotConn")
+			}
+		},
+		DNSStart:             func(string) { record("DNSStart") },
+		DNSDone:              func([]net.IPAddr, error) { record("DNSDone") },
+		ConnectStart:         func(string, string) { record("ConnectStart") },
+		ConnectDone:          func(string, string, error) { record("ConnectDone") },
+		TLSHandshakeStart:    func() { record("TLSHandshakeStart") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { record("TLSHandshakeDone") },
+		WroteHeaders:         func() { record("WroteHeaders") },
+		Got100Continue:       func() { record("Got100Continue") },
+		WroteRequest:         func(error) { record("WroteRequest") },
+		GotFirstResponseByte: func() { record("GotFirstResponseByte") },
+		BodyDone:             func(int64, error) { record("BodyDone") },
+	}
+	return t, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), events...)
+	}
+}
+
+// subsequence reports whether expected appears in order within actual.
+func subsequence(expected, actual []string) bool {
+	for _, a := range actual {
+		if len(expected) > 0 && a == expected[0] {
+			expected = expected[1:]
+		}
+	}
+	return len(expected) == 0
+}
+
+var traceTests = []struct {
+	Client
+	tls    bool
+	path   string
+	body   string
+	first  string // events expected for a request on a new connection
+	second string // events expected for a request on a reused connection
+}{
+	{
+		Client: Client{},
+		path:   "/200",
+		first:  "GetConn DNSStart DNSDone ConnectStart ConnectDone GotConn WroteHeaders WroteRequest GotFirstResponseByte BodyDone",
+		second: "GetConn GotConn(reused) WroteHeaders WroteRequest GotFirstResponseByte BodyDone",
+	},
+	{
+		Client: Client{ExpectContinue: 10 * time.Second},
+		path:   "/201",
+		body:   postBody,
+		// the 100 Continue is the first response byte, and the connection is not reused.
+		first:  "GetConn GotConn WroteHeaders GotFirstResponseByte Got100Continue WroteRequest BodyDone",
+		second: "GetConn GotConn WroteHeaders GotFirstResponseByte Got100Continue WroteRequest BodyDone",
+	},
+	{
+		Client: Client{TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+		tls:    true,
+		path:   "/200",
+		first:  "GetConn DNSStart DNSDone ConnectStart ConnectDone TLSHandshakeStart TLSHandshakeDone GotConn WroteHeaders WroteRequest GotFirstResponseByte BodyDone",
+		second: "GetConn GotConn(reused) WroteHeaders WroteRequest GotFirstResponseByte BodyDone",
+	},
+	{
+		Client: Client{TLSConfig: &tls.Config{InsecureSkipVerify: true}, HTTP2: true},
+		tls:    true,
+		path:   "/200",
+		first:  "GetConn DNSStart DNSDone ConnectStart ConnectDone TLSHandshakeStart TLSHandshakeDone GotConn WroteHeaders WroteRequest GotFirstResponseByte BodyDone",
+		second: "GetConn GotConn(reused) WroteHeaders WroteRequest GotFirstResponseByte BodyDone",
+	},
+}
+
+func TestDoContextTrace(t *testing.T) {
+	s := newServer(t, stdmux())
+	defer s.Shutdown()
+	ts := newTLSServer(t, stdmux())
+	for _, tt := range traceTests {
+		root := s.Root()
+		if tt.tls {
+			root = ts.URL
+		}
+		// look up localhost, rather than dialing the address directly.
+		_, port, _ := net.SplitHostPort(root[strings.LastIndex(root, "/")+1:])
+		url := strings.SplitN(root, ":", 2)[0] + "://localhost:" + port + tt.path
+		c := tt.Client
+		c.dialer = new(dialer)
+		for _, expected := range []string{tt.first, tt.second} {
+			trace, events := traceEvents()
+			var body io.Reader
+			method := "GET"
+			if tt.body != "" {
+				method, body = "POST", strings.NewReader(tt.body)
+			}
+			_, _, r, err := c.DoContext(client.WithTrace(context.Background(), trace), method, url, nil, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, r)
+			r.Close()
+			if actual := events(); !subsequence(strings.Split(expected, " "), actual) || strings.Contains(strings.Join(actual, " "), "BodyDone BodyDone") {
+				t.Errorf("%s %s: expected events %q, got %q", method, url, expected, actual)
+			}
+		}
+	}
+}
+
+func TestDoContextCancelDial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &Client{dialer: new(dialer)}
+	if _, _, _, err := c.DoContext(ctx, "GET", "http://localhost:1/", nil, nil); err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Errorf("DoContext: expected context canceled, got %v", err)
+	}
+}
+
+func TestDoContextCancelHeaders(t *testing.T) {
+	l, err := net.ListenTCP("tcp4", localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// accept the connection, but never respond.
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(io.Discard, c)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c := &Client{dialer: new(dialer)}
+	if _, _, _, err := c.DoContext(ctx, "GET", "http://"+l.Addr().String()+"/", nil, nil); err != context.DeadlineExceeded {
+		t.Errorf("DoContext: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if s := c.Stats()[l.Addr().String()]; s.Active != 0 || s.Closed != 1 {
+		t.Errorf("Stats: expected the connection closed, got %+v", s)
+	}
+}
+
+var dialParallelTests = []struct {
+	primary string // fails, or does not answer
+}{
+	{"192.0.2.1:80"}, // rfc 5737 TEST-NET-1, which is not routed.
+	{"127.0.0.1:1"},
+}
+
+// a traced dial falls back to the other addresses if the first do not connect.
+func TestDialParallel(t *testing.T) {
+	l, err := net.ListenTCP("tcp4", localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	for _, tt := range dialParallelTests {
+		var mu sync.Mutex
+		var started []string
+		trace := &client.Trace{ConnectStart: func(_, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			started = append(started, addr)
+		}}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		start := time.Now()
+		c, err := dialParallel(ctx, trace, "tcp", []string{tt.primary}, []string{l.Addr().String()})
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			t.Fatalf("dialParallel(%s): %v", tt.primary, err)
+		}
+		c.Close()
+		if c.RemoteAddr().String() != l.Addr().String() || elapsed > 2*time.Second {
+			t.Errorf("dialParallel(%s): expected %s within 2s, got %s after %v", tt.primary, l.Addr(), c.RemoteAddr(), elapsed)
+		}
+		mu.Lock()
+		if len(started) != 2 || started[0] != tt.primary {
+			t.Errorf("dialParallel(%s): expected both addresses dialed, primary first, got %q", tt.primary, started)
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TraceParent identifies the span of a distributed trace, as carried by the
+// traceparent and tracestate headers of the W3C Trace Context,
+// https://www.w3.org/TR/trace-context/.
+type TraceParent struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+
+	// State is the vendor specific tracestate, sent as given.
+	State string
+}
+
+// Sampled reports whether the sampled flag is set.
+func (t TraceParent) Sampled() bool { return t.Flags&1 != 0 }
+
+// String returns t formatted as a version 00 traceparent header value.
+func (t TraceParent) String() string {
+	return fmt.Sprintf("00-%x-%x-%02x", t.TraceID, t.SpanID, t.Flags)
+}
+
+var errTraceParent = errors.New("invalid traceparent")
+
+// ParseTraceParent parses a traceparent header value. Values of versions
+// after 00 are parsed as far as version 00 defines them.
+func ParseTraceParent(s string) (TraceParent, error) {
+	var t TraceParent
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return t, errTraceParent
+	}
+	switch version := s[:2]; {
+	case version == "ff", !isLowerHex(version):
+		return t, errTraceParent
+	case version == "00" && len(s) != 55:
+		return t, errTraceParent
+	case len(s) > 55 && s[55] != '-':
+		return t, errTraceParent
+	}
+	var flags [1]byte
+	for _, f := range []struct {
+		dst []byte
+		src string
+	}{{t.TraceID[:], s[3:35]}, {t.SpanID[:], s[36:52]}, {flags[:], s[53:55]}} {
+		if !isLowerHex(f.src) {
+			return t, errTraceParent
+		}
+		hex.Decode(f.dst, []byte(f.src))
+	}
+	if t.TraceID == [16]byte{} || t.SpanID == [8]byte{} {
+		return t, errTraceParent
+	}
+	t.Flags = flags[0]
+	return t, nil
+}
+
+func isLowerHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+type traceParentKey struct{}
+
+// WithTraceParent returns a copy of ctx carrying t, which requests made with
+// the context by a Client with PropagateTraceContext set send as their
+// traceparent and tracestate headers. A Tracer should add the TraceParent of
+// the span it starts.
+func WithTraceParent(ctx context.Context, t TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, t)
+}
+
+// ContextTraceParent returns the TraceParent carried by ctx, if any.
+func ContextTraceParent(ctx context.Context) (TraceParent, bool) {
+	t, ok := ctx.Value(traceParentKey{}).(TraceParent)
+	return t, ok
+}
+
+// propagate adds the traceparent and tracestate headers of the TraceParent
+// carried by ctx to headers, unless they already carry a traceparent.
+func propagate(ctx context.Context, headers map[string][]string) {
+	t, ok := ContextTraceParent(ctx)
+	if !ok {
+		return
+	}
+	if _, ok := header(headers, "traceparent"); ok {
+		return
+	}
+	headers["traceparent"] = []string{t.String()}
+	if t.State != "" {
+		headers["tracestate"] = []string{t.State}
+	}
+}
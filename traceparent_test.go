@@ -0,0 +1,95 @@
+package http
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+var parseTraceParentTests = []struct {
+	value    string
+	expected TraceParent
+	err      bool
+}{
+	{
+		value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		expected: TraceParent{
+			TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+			SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+			Flags:   1,
+		},
+	},
+	{
+		// later versions may add fields.
+		value: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what-the-future-holds",
+		expected: TraceParent{
+			TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+			SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		},
+	},
+	{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", err: true},
+	{value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", err: true},
+	{value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", err: true},
+	{value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", err: true},
+	{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", err: true},
+	{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x", err: true},
+	{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", err: true},
+	{value: "", err: true},
+}
+
+func TestParseTraceParent(t *testing.T) {
+	for _, tt := range parseTraceParentTests {
+		actual, err := ParseTraceParent(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseTraceParent(%q): expected error", tt.value)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("ParseTraceParent(%q): expected %+v, got %+v, %v", tt.value, tt.expected, actual, err)
+		}
+	}
+}
+
+func TestTraceParentString(t *testing.T) {
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tp, err := ParseTraceParent(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp.String() != value || !tp.Sampled() {
+		t.Errorf("String: expected sampled %q, got %q", value, tp.String())
+	}
+}
+
+var propagateTests = []struct {
+	headers  map[string][]string
+	expected map[string][]string
+}{
+	{
+		headers:  map[string][]string{},
+		expected: map[string][]string{"traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, "tracestate": {"congo=t61rcWkgMzE"}},
+	},
+	{
+		// the caller's trace context is sent as given.
+		headers:  map[string][]string{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"}},
+		expected: map[string][]string{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"}},
+	},
+}
+
+func TestPropagate(t *testing.T) {
+	tp, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tp.State = "congo=t61rcWkgMzE"
+	ctx := WithTraceParent(context.Background(), tp)
+	for _, tt := range propagateTests {
+		propagate(ctx, tt.headers)
+		if !reflect.DeepEqual(tt.headers, tt.expected) {
+			t.Errorf("propagate: expected %v, got %v", tt.expected, tt.headers)
+		}
+	}
+	h := map[string][]string{}
+	if propagate(context.Background(), h); len(h) != 0 {
+		t.Errorf("propagate: expected no headers without a TraceParent, got %v", h)
+	}
+}
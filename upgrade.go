@@ -0,0 +1,157 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	stdurl "net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/http/client"
+)
+
+// Upgraded is a connection taken over from the Client after the server agreed
+// to switch protocols with a 101 Switching Protocols response, rfc 9110 s7.8.
+// The Client no longer manages the connection, which must be closed.
+type Upgraded struct {
+	// Conn is the underlying connection. Data must be read through Reader,
+	// which may already hold data sent by the server using the new protocol.
+	Conn net.Conn
+
+	// Reader is the buffered reader which read the 101 response from Conn.
+	Reader *bufio.Reader
+
+	// Headers holds the headers of the 101 response.
+	Headers map[string][]string
+
+	closer io.Closer // closes Conn, counting it as closed by its pool
+}
+
+// Read reads from the connection, through Reader.
+func (u *Upgraded) Read(p []byte) (int, error) { return u.Reader.Read(p) }
+
+// Write writes to the connection.
+func (u *Upgraded) Write(p []byte) (int, error) { return u.Conn.Write(p) }
+
+// Close closes the connection.
+func (u *Upgraded) Close() error {
+	if u.closer != nil {
+		return u.closer.Close()
+	}
+	return u.Conn.Close()
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (u *Upgraded) SetDeadline(t time.Time) error { return u.Conn.SetDeadline(t) }
+
+// maxRejectedBody limits how much of the body of a response refusing an
+// upgrade is read to form the error returned by Upgrade.
+const maxRejectedBody = 512
+
+// UpgradeError is returned by Upgrade if the server did not switch protocols.
+type UpgradeError struct {
+	client.Status
+	Headers map[string][]string
+
+	// Body holds the start of the response body.
+	Body []byte
+}
+
+func (e *UpgradeError) Error() string {
+	return fmt.Sprintf("upgrade refused: %v", e.Status)
+}
+
+// Upgrade sends a GET request asking the server to switch the connection to
+// protocol, for example "websocket". If the server responds with 101 Switching
+// Protocols the connection is returned for use with the new protocol. Any other
+// response is returned as an *UpgradeError.
+//
+// Upgrade always uses HTTP/1.1, as HTTP/2 does not support the Upgrade header.
+func (c *Client) Upgrade(url string, headers map[string][]string, protocol string) (*Upgraded, error) {
+	return c.UpgradeContext(context.Background(), url, headers, protocol)
+}
+
+// UpgradeContext is like Upgrade, but dialing and the handshake are abandoned
+// if ctx is done before the response is read. ctx has no effect on the
+// returned connection.
+func (c *Client) UpgradeContext(ctx context.Context, url string, headers map[string][]string, protocol string) (*Upgraded, error) {
+	u, err := stdurl.ParseRequestURI(url)
+	if err != nil {
+		return nil, err
+	}
+	h := make(map[string][]string, len(headers)+3)
+	for k, v := range headers {
+		h[k] = v
+	}
+	h["Host"] = []string{u.Host}
+	h["Connection"] = []string{"Upgrade"}
+	h["Upgrade"] = []string{protocol}
+	host, path, query := target(u)
+	conn, err := c.dialHTTP1(ctx, u.Scheme, host)
+	if err != nil {
+		return nil, err
+	}
+	setTranscript(conn, c.Transcript)
+	stop := interrupt(ctx, conn)
+	resp, err := upgrade(conn, toRequest("GET", path, query, h, nil), protocol)
+	if stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func upgrade(cn Conn, req *client.Request, protocol string) (*Upgraded, error) {
+	resp, _, err := sendHTTP1(cn, req)
+	if err != nil {
+		return nil, err
+	}
+	_, status, headers, body := fromResponse(resp)
+	if status.Code != client.INFO_SWITCHING_PROTOCOL {
+		b, _ := io.ReadAll(io.LimitReader(body, maxRejectedBody))
+		return nil, &UpgradeError{Status: status, Headers: headers, Body: b}
+	}
+	if !hasToken(headers, "Upgrade", protocol) {
+		return nil, fmt.Errorf("upgrade: server switched to %q, not %q", headerValue(headers, "Upgrade"), protocol)
+	}
+	br, ok := body.(*bufio.Reader)
+	if !ok {
+		return nil, errors.New("upgrade: connection does not support switching protocols")
+	}
+	var nc net.Conn
+	switch c := cn.(type) {
+	case *conn:
+		nc = c.Conn
+	case net.Conn:
+		nc = c
+	default:
+		return nil, errors.New("upgrade: connection does not support switching protocols")
+	}
+	// the conn remains active in its pool until it is closed.
+	return &Upgraded{Conn: nc, Reader: br, Headers: headers, closer: cn}, nil
+}
+
+// hasToken reports whether the comma separated values of the header key include token.
+func hasToken(headers map[string][]string, key, token string) bool {
+	for k, v := range headers {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+		for _, v := range v {
+			for _, t := range strings.Split(v, ",") {
+				if strings.EqualFold(strings.TrimSpace(t), token) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
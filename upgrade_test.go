@@ -0,0 +1,152 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// upgradeMux switches to a line echo protocol, "echo", after greeting the client.
+func upgradeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "echo protocol required", http.StatusBadRequest)
+			return
+		}
+		protocol := "echo"
+		if r.URL.Path == "/other" {
+			protocol = "other"
+		}
+		c, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		// the greeting is sent with the response, so is buffered by the client.
+		fmt.Fprintf(c, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\ngreeting\n", protocol)
+		for {
+			line, err := brw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			io.WriteString(c, "echo: "+line)
+		}
+	})
+	return mux
+}
+
+func TestClientUpgrade(t *testing.T) {
+	s := newServer(t, upgradeMux())
+	defer s.Shutdown()
+	c := &Client{dialer: new(dialer)}
+	u, err := c.Upgrade(s.Root()+"/", nil, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	if expected := "echo"; headerValue(u.Headers, "Upgrade") != expected {
+		t.Errorf("Upgrade: expected Upgrade: %q, got %v", expected, u.Headers)
+	}
+	br := bufio.NewReader(u)
+	if line, err := br.ReadString('\n'); err != nil || line != "greeting\n" {
+		t.Fatalf("Upgraded.Read: expected %q, got %q %v", "greeting\n", line, err)
+	}
+	for _, msg := range []string{"hello\n", "world\n"} {
+		if _, err := io.WriteString(u, msg); err != nil {
+			t.Fatal(err)
+		}
+		if line, err := br.ReadString('\n'); err != nil || line != "echo: "+msg {
+			t.Errorf("Upgraded.Read: expected %q, got %q %v", "echo: "+msg, line, err)
+		}
+	}
+}
+
+// an upgraded connection is active in its pool until it is closed.
+func TestClientUpgradeStats(t *testing.T) {
+	s := newServer(t, upgradeMux())
+	defer s.Shutdown()
+	c := &Client{dialer: new(dialer)}
+	var closed int
+	c.SetPoolHooks(PoolHooks{OnClose: func(string, net.Conn) { closed++ }})
+	u, err := c.Upgrade(s.Root()+"/", nil, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := s.Addr().String()
+	if st := c.Stats()[pool]; st.Active != 1 || st.Closed != 0 {
+		t.Errorf("Stats: expected 1 active, got %+v", st)
+	}
+	u.Close()
+	if st := c.Stats()[pool]; st.Active != 0 || st.Closed != 1 || closed != 1 {
+		t.Errorf("Stats: expected 1 closed, got %+v, %d OnClose", st, closed)
+	}
+}
+
+func TestClientUpgradeRefused(t *testing.T) {
+	s := newServer(t, upgradeMux())
+	defer s.Shutdown()
+	c := &Client{dialer: new(dialer)}
+	_, err := c.Upgrade(s.Root()+"/", nil, "carrier-pigeon")
+	var ue *UpgradeError
+	if !errors.As(err, &ue) {
+		t.Fatalf("Upgrade: expected %T, got %v", ue, err)
+	}
+	if ue.Code != 400 || string(ue.Body) != "echo protocol required\n" {
+		t.Errorf("Upgrade: expected 400 %q, got %v %q", "echo protocol required\n", ue.Status, ue.Body)
+	}
+	if _, err := c.Upgrade(s.Root()+"/other", nil, "echo"); err == nil {
+		t.Error("Upgrade: expected error when switching to another protocol, got nil")
+	}
+}
+
+// the caller's headers are not changed.
+func TestClientUpgradeHeaders(t *testing.T) {
+	s := newServer(t, upgradeMux())
+	defer s.Shutdown()
+	c := &Client{dialer: new(dialer)}
+	headers := map[string][]string{"X-Test": {"1"}}
+	u, err := c.Upgrade(s.Root()+"/", headers, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Close()
+	if expected := map[string][]string{"X-Test": {"1"}}; !reflect.DeepEqual(headers, expected) {
+		t.Errorf("Upgrade: expected headers %v, got %v", expected, headers)
+	}
+}
+
+// the handshake is abandoned once its context is done.
+func TestClientUpgradeContext(t *testing.T) {
+	l, err := net.ListenTCP("tcp4", localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// accept, and never answer.
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	c := &Client{dialer: new(dialer)}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.UpgradeContext(ctx, "http://"+l.Addr().String()+"/", nil, "echo"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UpgradeContext: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if st := c.Stats()[l.Addr().String()]; st.Active != 0 || st.Closed != 1 {
+		t.Errorf("Stats: expected the connection closed, got %+v", st)
+	}
+}
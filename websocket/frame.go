@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+)
+
+// opcodes, rfc 6455 s5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// maxControlPayload is the largest payload of a control frame, rfc 6455 s5.5.
+const maxControlPayload = 125
+
+// frameHeader is the header of a frame, rfc 6455 s5.2.
+type frameHeader struct {
+	fin    bool
+	rsv    byte // the three reserved bits, which must be zero without extensions
+	op     byte
+	masked bool
+	mask   [4]byte
+	length int64
+}
+
+func (h frameHeader) isControl() bool { return h.op&0x8 != 0 }
+
+func readFrameHeader(r *bufio.Reader) (frameHeader, error) {
+	var h frameHeader
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return h, err
+	}
+	h.fin = b[0]&0x80 != 0
+	h.rsv = b[0] & 0x70 >> 4
+	h.op = b[0] & 0xf
+	h.masked = b[1]&0x80 != 0
+	switch l := b[1] & 0x7f; l {
+	case 126:
+		if _, err := io.ReadFull(r, b[:2]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(r, b[:8]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		h.length = int64(binary.BigEndian.Uint64(b[:8]))
+		if h.length < 0 {
+			return h, protocolError("frame length overflows")
+		}
+	default:
+		h.length = int64(l)
+	}
+	if h.masked {
+		if _, err := io.ReadFull(r, h.mask[:]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+	}
+	return h, nil
+}
+
+// appendFrame appends a frame carrying payload to dst. If masked, the
+// payload is masked with a random key, as clients must, rfc 6455 s5.3.
+func appendFrame(dst []byte, fin bool, op byte, payload []byte, masked bool) ([]byte, error) {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	var b1 byte
+	if masked {
+		b1 = 0x80
+	}
+	switch l := len(payload); {
+	case l < 126:
+		dst = append(dst, b0, b1|byte(l))
+	case l <= 0xffff:
+		dst = append(dst, b0, b1|126)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(l))
+	default:
+		dst = append(dst, b0, b1|127)
+		dst = binary.BigEndian.AppendUint64(dst, uint64(l))
+	}
+	if !masked {
+		return append(dst, payload...), nil
+	}
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	dst = append(dst, key[:]...)
+	n := len(dst)
+	dst = append(dst, payload...)
+	maskBytes(key, dst[n:])
+	return dst, nil
+}
+
+// maskBytes masks, or unmasks, b with key, rfc 6455 s5.3.
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,438 @@
+// Package websocket implements the client side of the WebSocket protocol,
+// rfc 6455, on top of the connection returned by gorilla/http.Client.Upgrade.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/http"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = opText
+	BinaryMessage MessageType = opBinary
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case TextMessage:
+		return "text"
+	case BinaryMessage:
+		return "binary"
+	default:
+		return fmt.Sprintf("MessageType(%d)", int(t))
+	}
+}
+
+// Close codes, rfc 6455 s7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// acceptGUID is appended to Sec-WebSocket-Key to form Sec-WebSocket-Accept, rfc 6455 s1.3.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DefaultMaxMessageSize is the largest message ReadMessage will accept from
+// a Conn with no MaxMessageSize.
+const DefaultMaxMessageSize = 32 << 20
+
+// closeTimeout is how long Close waits for the server to answer a close frame.
+const closeTimeout = 5 * time.Second
+
+// CloseError is returned by ReadMessage once the connection has been closed
+// by a close frame.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Text)
+}
+
+// protocolError is a violation of the protocol by the server. The connection
+// is closed with CloseProtocolError.
+type protocolError string
+
+func (e protocolError) Error() string { return "websocket: protocol error: " + string(e) }
+
+// ErrCloseSent is returned when writing a message after a close frame has been sent.
+var ErrCloseSent = errors.New("websocket: close sent")
+
+// Conn is a WebSocket connection. A Conn supports one concurrent reader
+// and one concurrent writer; pings are answered while reading.
+type Conn struct {
+	rw          io.ReadWriteCloser
+	br          *bufio.Reader
+	setDeadline func(time.Time) error
+	subprotocol string
+
+	// MaxMessageSize is the largest message ReadMessage will accept, or if
+	// zero, DefaultMaxMessageSize. Larger messages close the connection with
+	// CloseMessageTooBig.
+	MaxMessageSize int64
+
+	// OnPong, if non nil, is called with the application data of each pong
+	// received while reading.
+	OnPong func(data []byte)
+
+	readErr error // the error which ended reading, returned by subsequent reads
+
+	wmu       sync.Mutex // protects the following fields and writes to rw
+	wbuf      []byte
+	closeSent bool
+}
+
+// Dial opens a WebSocket connection to url, which may use the ws, wss, http
+// or https schemes, using c, or http.DefaultClient if c is nil. Any
+// subprotocols in a Sec-WebSocket-Protocol header are offered to the server.
+func Dial(c *http.Client, url string, headers map[string][]string) (*Conn, error) {
+	return DialContext(context.Background(), c, url, headers)
+}
+
+// DialContext is like Dial, but the opening handshake is abandoned if ctx is
+// done before it completes. ctx has no effect on the returned Conn.
+func DialContext(ctx context.Context, c *http.Client, url string, headers map[string][]string) (*Conn, error) {
+	if c == nil {
+		c = &http.DefaultClient
+	}
+	switch {
+	case strings.HasPrefix(url, "ws://"):
+		url = "http://" + url[len("ws://"):]
+	case strings.HasPrefix(url, "wss://"):
+		url = "https://" + url[len("wss://"):]
+	}
+	h := make(map[string][]string, len(headers)+2)
+	for k, v := range headers {
+		h[k] = v
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	h["Sec-WebSocket-Key"] = []string{key}
+	h["Sec-WebSocket-Version"] = []string{"13"}
+	u, err := c.UpgradeContext(ctx, url, h, "websocket")
+	if err != nil {
+		return nil, err
+	}
+	subprotocol, err := checkHandshake(u.Headers, key, header(headers, "Sec-WebSocket-Protocol"))
+	if err != nil {
+		u.Close()
+		return nil, err
+	}
+	return &Conn{
+		rw:          u,
+		br:          u.Reader,
+		setDeadline: u.SetDeadline,
+		subprotocol: subprotocol,
+	}, nil
+}
+
+// checkHandshake validates the server's handshake response, rfc 6455 s4.1,
+// returning the subprotocol chosen by the server, if any.
+func checkHandshake(headers map[string][]string, key string, offered []string) (string, error) {
+	if accept := strings.Join(header(headers, "Sec-WebSocket-Accept"), ""); accept != acceptKey(key) {
+		return "", fmt.Errorf("websocket: invalid Sec-WebSocket-Accept %q", accept)
+	}
+	if ext := header(headers, "Sec-WebSocket-Extensions"); len(ext) > 0 {
+		return "", fmt.Errorf("websocket: server selected unrequested extensions %q", ext)
+	}
+	subprotocol := strings.Join(header(headers, "Sec-WebSocket-Protocol"), ",")
+	if subprotocol == "" {
+		return "", nil
+	}
+	for _, v := range offered {
+		for _, p := range strings.Split(v, ",") {
+			if strings.TrimSpace(p) == subprotocol {
+				return subprotocol, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("websocket: server selected unrequested subprotocol %q", subprotocol)
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value expected for key.
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// header returns the values of the header key, matched case insensitively.
+func header(headers map[string][]string, key string) []string {
+	var v []string
+	for k, vv := range headers {
+		if strings.EqualFold(k, key) {
+			v = append(v, vv...)
+		}
+	}
+	return v
+}
+
+// Subprotocol returns the subprotocol selected by the server, if any.
+func (c *Conn) Subprotocol() string { return c.subprotocol }
+
+// ReadMessage reads the next data message, reassembling fragmented messages
+// and answering any pings received meanwhile. Once the server closes the
+// connection, a *CloseError is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	t, msg, err := c.readMessage()
+	if err != nil {
+		c.readErr = err
+		switch err := err.(type) {
+		case protocolError:
+			c.WriteClose(CloseProtocolError, "")
+		case *messageError:
+			c.WriteClose(err.code, "")
+		}
+	}
+	return t, msg, err
+}
+
+// messageError is a message the Conn will not accept, closing the connection with code.
+type messageError struct {
+	code int
+	msg  string
+}
+
+func (e *messageError) Error() string { return "websocket: " + e.msg }
+
+func (c *Conn) maxMessageSize() int64 {
+	if c.MaxMessageSize > 0 {
+		return c.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
+}
+
+func (c *Conn) readMessage() (MessageType, []byte, error) {
+	var t MessageType
+	var msg []byte
+	for {
+		h, err := readFrameHeader(c.br)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case h.rsv != 0:
+			return 0, nil, protocolError("reserved bits set")
+		case h.masked:
+			return 0, nil, protocolError("masked frame from server")
+		case h.isControl() && (!h.fin || h.length > maxControlPayload):
+			return 0, nil, protocolError("invalid control frame")
+		}
+		// the length is checked before the payload is allocated, as it may
+		// be anything up to 2^63-1.
+		if max := c.maxMessageSize(); h.length > max-int64(len(msg)) {
+			return 0, nil, &messageError{CloseMessageTooBig, fmt.Sprintf("message exceeds maximum of %d bytes", max)}
+		}
+		payload := make([]byte, h.length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+		switch h.op {
+		case opPing:
+			if err := c.writeFrame(true, opPong, payload); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if c.OnPong != nil {
+				c.OnPong(payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, c.readClose(payload)
+		case opText, opBinary:
+			if t != 0 {
+				return 0, nil, protocolError("new message before previous message finished")
+			}
+			t = MessageType(h.op)
+		case opContinuation:
+			if t == 0 {
+				return 0, nil, protocolError("continuation frame without a message")
+			}
+		default:
+			return 0, nil, protocolError(fmt.Sprintf("unknown opcode %d", h.op))
+		}
+		msg = append(msg, payload...)
+		if !h.fin {
+			continue
+		}
+		if t == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, &messageError{CloseInvalidFramePayloadData, "invalid UTF-8 in text message"}
+		}
+		return t, msg, nil
+	}
+}
+
+// readClose handles a close frame from the server, answering it if this side
+// has not yet sent a close frame, rfc 6455 s5.5.1.
+func (c *Conn) readClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return protocolError("invalid close frame")
+	case len(payload) >= 2:
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Text = string(payload[2:])
+		if !validCloseCode(ce.Code) || !utf8.ValidString(ce.Text) {
+			return protocolError("invalid close frame")
+		}
+	}
+	code := ce.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	if err := c.WriteClose(code, ""); err != nil && err != ErrCloseSent {
+		return err
+	}
+	return ce
+}
+
+// validCloseCode reports whether code may be sent in a close frame, rfc 6455 s7.4.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// WriteMessage sends data as a single message.
+func (c *Conn) WriteMessage(t MessageType, data []byte) error {
+	if t != TextMessage && t != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %v", t)
+	}
+	return c.writeFrame(true, byte(t), data)
+}
+
+// NextWriter returns a writer which sends a message of type t as a series of
+// fragments, one per Write, rfc 6455 s5.4. The message is finished by closing
+// the writer, which must be done before another message is written.
+func (c *Conn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	if t != TextMessage && t != BinaryMessage {
+		return nil, fmt.Errorf("websocket: invalid message type %v", t)
+	}
+	return &messageWriter{c: c, op: byte(t)}, nil
+}
+
+type messageWriter struct {
+	c  *Conn
+	op byte // opcode of the next frame
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.c.writeFrame(false, w.op, p); err != nil {
+		return 0, err
+	}
+	w.op = opContinuation
+	return len(p), nil
+}
+
+func (w *messageWriter) Close() error {
+	return w.c.writeFrame(true, w.op, nil)
+}
+
+// WritePing sends a ping carrying data, which must be at most 125 bytes.
+func (c *Conn) WritePing(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: ping payload too large")
+	}
+	return c.writeFrame(true, opPing, data)
+}
+
+// WriteClose sends a close frame carrying code and text, starting the closing
+// handshake. No further messages may be written.
+func (c *Conn) WriteClose(code int, text string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, text...)
+	if len(payload) > maxControlPayload {
+		return errors.New("websocket: close text too long")
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	c.closeSent = true
+	return c.write(true, opClose, payload)
+}
+
+func (c *Conn) writeFrame(fin bool, op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	return c.write(fin, op, payload)
+}
+
+// write sends a frame. The caller must hold wmu.
+func (c *Conn) write(fin bool, op byte, payload []byte) error {
+	var err error
+	c.wbuf, err = appendFrame(c.wbuf[:0], fin, op, payload, true)
+	if err != nil {
+		return err
+	}
+	_, err = c.rw.Write(c.wbuf)
+	return err
+}
+
+// Close performs the closing handshake, sending a close frame with
+// CloseNormalClosure if one has not been sent and waiting for the server's
+// close frame, before closing the connection. Messages received meanwhile
+// are discarded. Close must not be called concurrently with ReadMessage.
+func (c *Conn) Close() error {
+	err := c.WriteClose(CloseNormalClosure, "")
+	if err == ErrCloseSent {
+		err = nil
+	}
+	if err == nil && c.readErr == nil {
+		c.setDeadline(time.Now().Add(closeTimeout))
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				break
+			}
+		}
+	}
+	if cerr := c.rw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,349 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/http"
+)
+
+// serverConn is the server side of a connection, as seen by the test server.
+type serverConn struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+func (s *serverConn) write(fin bool, op byte, payload []byte) {
+	b, _ := appendFrame(nil, fin, op, payload, false)
+	s.Write(b)
+}
+
+func (s *serverConn) read() (frameHeader, []byte, error) {
+	h, err := readFrameHeader(s.br)
+	if err != nil {
+		return h, nil, err
+	}
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(s.br, payload); err != nil {
+		return h, nil, err
+	}
+	if !h.masked {
+		return h, nil, errors.New("unmasked frame from client")
+	}
+	maskBytes(h.mask, payload)
+	return h, payload, nil
+}
+
+func closePayload(code int, text string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), text...)
+}
+
+// echo is a WebSocket server which greets each connection, then echoes each
+// message received. Some messages trigger special behaviour.
+func echo(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	if r.URL.Path == "/forbidden" {
+		stdhttp.Error(w, "go away", stdhttp.StatusForbidden)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		stdhttp.Error(w, "not a websocket handshake", stdhttp.StatusBadRequest)
+		return
+	}
+	accept := acceptKey(r.Header.Get("Sec-WebSocket-Key"))
+	if r.URL.Path == "/badaccept" {
+		accept = "bad"
+	}
+	nc, brw, err := w.(stdhttp.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer nc.Close()
+	s := &serverConn{nc, brw.Reader}
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n"
+	if p := r.Header.Get("Sec-WebSocket-Protocol"); p != "" {
+		resp += "Sec-WebSocket-Protocol: " + strings.Split(p, ",")[0] + "\r\n"
+	}
+	// the greeting is sent with the handshake response, so is buffered by the client.
+	greeting, _ := appendFrame(nil, true, opText, []byte("hello"), false)
+	s.Write(append([]byte(resp+"\r\n"), greeting...))
+
+	var op byte // opcode of the message being received
+	var msg []byte
+	for {
+		h, payload, err := s.read()
+		if err != nil {
+			return
+		}
+		switch h.op {
+		case opClose:
+			s.write(true, opClose, payload)
+			return
+		case opPing:
+			s.write(true, opPong, payload)
+			continue
+		case opPong:
+			s.write(true, opText, append([]byte("pong "), payload...))
+			continue
+		}
+		if h.op != opContinuation {
+			op = h.op
+		}
+		msg = append(msg, payload...)
+		if !h.fin {
+			continue
+		}
+		switch string(msg) {
+		case "fragment":
+			// a fragmented message, interrupted by a ping.
+			s.write(false, opText, []byte("frag"))
+			s.write(true, opPing, []byte("p"))
+			s.write(true, opContinuation, []byte("ment"))
+		case "close":
+			s.write(true, opClose, closePayload(CloseGoingAway, "bye"))
+		case "badutf8":
+			s.write(true, opText, []byte{0xff, 0xfe})
+		case "masked":
+			b, _ := appendFrame(nil, true, opText, []byte("masked"), true)
+			s.Write(b)
+		case "huge":
+			// a header claiming a payload of 2^62 bytes.
+			s.Write(binary.BigEndian.AppendUint64([]byte{0x80 | opBinary, 127}, 1<<62))
+		default:
+			s.write(true, op, msg)
+		}
+		msg = nil
+	}
+}
+
+func newServer(t *testing.T) string {
+	s := httptest.NewServer(stdhttp.HandlerFunc(echo))
+	t.Cleanup(s.Close)
+	return "ws://" + strings.TrimPrefix(s.URL, "http://")
+}
+
+func dial(t *testing.T, url string) *Conn {
+	c, err := Dial(&http.Client{}, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "hello" {
+		t.Fatalf("greeting: expected %q, got %q %v", "hello", msg, err)
+	}
+	return c
+}
+
+var echoTests = []struct {
+	t   MessageType
+	msg string
+}{
+	{TextMessage, ""},
+	{TextMessage, "hello world"},
+	{BinaryMessage, "\x00\x01\x02"},
+	{TextMessage, strings.Repeat("a", 125)},
+	{TextMessage, strings.Repeat("b", 126)},
+	{BinaryMessage, strings.Repeat("c", 0xffff)},
+	{BinaryMessage, strings.Repeat("d", 0x10000)},
+}
+
+func TestConnEcho(t *testing.T) {
+	c := dial(t, newServer(t))
+	for _, tt := range echoTests {
+		if err := c.WriteMessage(tt.t, []byte(tt.msg)); err != nil {
+			t.Fatal(err)
+		}
+		typ, msg, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != tt.t || string(msg) != tt.msg {
+			t.Errorf("echo(%v, %d bytes): got %v %d bytes", tt.t, len(tt.msg), typ, len(msg))
+		}
+	}
+}
+
+func TestConnNextWriter(t *testing.T) {
+	c := dial(t, newServer(t))
+	w, err := c.NextWriter(TextMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"all ", "your ", "base"} {
+		if _, err := io.WriteString(w, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "all your base" {
+		t.Errorf("NextWriter: expected %q, got %q %v", "all your base", msg, err)
+	}
+}
+
+// pings interleaved with a fragmented message are answered.
+func TestConnFragmentedWithPing(t *testing.T) {
+	c := dial(t, newServer(t))
+	var pongs [][]byte
+	c.OnPong = func(data []byte) { pongs = append(pongs, data) }
+	if err := c.WriteMessage(TextMessage, []byte("fragment")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "fragment" {
+		t.Fatalf("ReadMessage: expected %q, got %q %v", "fragment", msg, err)
+	}
+	// the server reports the pong it received.
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "pong p" {
+		t.Errorf("ReadMessage: expected %q, got %q %v", "pong p", msg, err)
+	}
+	if err := c.WritePing([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteMessage(TextMessage, []byte("after ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "after ping" {
+		t.Errorf("ReadMessage: expected %q, got %q %v", "after ping", msg, err)
+	}
+	if expected := [][]byte{[]byte("ping")}; !reflect.DeepEqual(pongs, expected) {
+		t.Errorf("OnPong: expected %q, got %q", expected, pongs)
+	}
+}
+
+func TestConnServerClose(t *testing.T) {
+	c := dial(t, newServer(t))
+	if err := c.WriteMessage(TextMessage, []byte("close")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := c.ReadMessage()
+	if expected := (&CloseError{Code: CloseGoingAway, Text: "bye"}); !reflect.DeepEqual(err, expected) {
+		t.Errorf("ReadMessage: expected %v, got %v", expected, err)
+	}
+	if err := c.WriteMessage(TextMessage, []byte("too late")); err != ErrCloseSent {
+		t.Errorf("WriteMessage: expected %v, got %v", ErrCloseSent, err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	c := dial(t, newServer(t))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var ce *CloseError
+	if _, _, err := c.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseNormalClosure {
+		t.Errorf("ReadMessage: expected close %d, got %v", CloseNormalClosure, err)
+	}
+}
+
+var protocolErrorTests = []struct {
+	msg string
+	err error
+}{
+	{"badutf8", &messageError{CloseInvalidFramePayloadData, "invalid UTF-8 in text message"}},
+	{"masked", protocolError("masked frame from server")},
+}
+
+func TestConnProtocolErrors(t *testing.T) {
+	url := newServer(t)
+	for _, tt := range protocolErrorTests {
+		c := dial(t, url)
+		if err := c.WriteMessage(TextMessage, []byte(tt.msg)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := c.ReadMessage(); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("ReadMessage(%q): expected %v, got %v", tt.msg, tt.err, err)
+		}
+	}
+}
+
+func TestConnMaxMessageSize(t *testing.T) {
+	c := dial(t, newServer(t))
+	c.MaxMessageSize = 10
+	if err := c.WriteMessage(BinaryMessage, bytes.Repeat([]byte("x"), 11)); err != nil {
+		t.Fatal(err)
+	}
+	var me *messageError
+	if _, _, err := c.ReadMessage(); !errors.As(err, &me) || me.code != CloseMessageTooBig {
+		t.Errorf("ReadMessage: expected message too big, got %v", err)
+	}
+}
+
+func TestConnHugeFrame(t *testing.T) {
+	c := dial(t, newServer(t))
+	if err := c.WriteMessage(TextMessage, []byte("huge")); err != nil {
+		t.Fatal(err)
+	}
+	var me *messageError
+	if _, _, err := c.ReadMessage(); !errors.As(err, &me) || me.code != CloseMessageTooBig {
+		t.Errorf("ReadMessage: expected message too big, got %v", err)
+	}
+}
+
+func TestDialSubprotocol(t *testing.T) {
+	url := newServer(t)
+	c, err := Dial(nil, url, map[string][]string{"Sec-WebSocket-Protocol": {"chat, superchat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if p := c.Subprotocol(); p != "chat" {
+		t.Errorf("Subprotocol: expected %q, got %q", "chat", p)
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	url := newServer(t)
+	_, err := Dial(nil, url+"/forbidden", nil)
+	var ue *http.UpgradeError
+	if !errors.As(err, &ue) || ue.Code != 403 || !strings.Contains(string(ue.Body), "go away") {
+		t.Errorf("Dial(/forbidden): expected 403, got %v", err)
+	}
+	if _, err := Dial(nil, url+"/badaccept", nil); err == nil || !strings.Contains(err.Error(), "Sec-WebSocket-Accept") {
+		t.Errorf("Dial(/badaccept): expected Sec-WebSocket-Accept error, got %v", err)
+	}
+}
+
+// the handshake is abandoned once its context is done.
+func TestDialContext(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// accept, and never answer.
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := DialContext(ctx, nil, "ws://"+l.Addr().String()+"/", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DialContext: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// rfc 6455 s1.3
+	if actual, expected := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; actual != expected {
+		t.Errorf("acceptKey: expected %q, got %q", expected, actual)
+	}
+}